@@ -0,0 +1,128 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/wub/walnut"
+)
+
+// Maps file extensions to format names.
+var extensions = map[string]string{
+	".wn":   "walnut",
+	".json": "json",
+	".toml": "toml",
+	".yaml": "yaml",
+	".yml":  "yaml",
+	".ini":  "ini",
+}
+
+// Functions converting foreign formats to walnut source.
+var importers = map[string]func(in []byte) ([]byte, []walnut.Warning, error){
+	"json": func(in []byte) ([]byte, []walnut.Warning, error) {
+		out, err := walnut.FromJSON(in)
+		return out, nil, err
+	},
+	"toml": walnut.FromTOML,
+	"yaml": walnut.FromYAML,
+	"ini":  walnut.FromINI,
+}
+
+// Functions converting a Config to foreign formats.
+var exporters = map[string]func(conf walnut.Config) ([]byte, []walnut.Warning, error){
+	"json": walnut.ToJSON,
+	"toml": walnut.ToTOML,
+	"yaml": walnut.ToYAML,
+	"ini":  walnut.ToINI,
+}
+
+func convert(args []string) error {
+	fs := flag.NewFlagSet("convert", flag.ExitOnError)
+	from := fs.String("from", "", "input format (walnut, json, toml, yaml, ini)")
+	to := fs.String("to", "", "output format (walnut, json, toml, yaml, ini)")
+	r := addReadFlags(fs)
+	fs.Parse(args)
+
+	var in []byte
+	var warnings []walnut.Warning
+	var err error
+
+	switch fs.NArg() {
+	case 0:
+		in, err = ioutil.ReadAll(os.Stdin)
+	case 1:
+		in, err = ioutil.ReadFile(fs.Arg(0))
+		if *from == "" {
+			*from = extensions[filepath.Ext(fs.Arg(0))]
+		}
+	default:
+		return fmt.Errorf("too many arguments")
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if *from == "" {
+		*from = "walnut"
+	}
+	if *to == "" {
+		if *from == "walnut" {
+			*to = "json"
+		} else {
+			*to = "walnut"
+		}
+	}
+
+	// convert the input to walnut source, unless it already is
+	src := in
+	if *from != "walnut" {
+		imp, ok := importers[*from]
+		if !ok {
+			return fmt.Errorf("unknown input format %q", *from)
+		}
+		if src, warnings, err = imp(in); err != nil {
+			return err
+		}
+		report(warnings)
+	}
+
+	// validate the source even when walnut is the target format
+	conf, err := r.read(src)
+	if err != nil {
+		return err
+	}
+
+	out := src
+	if *to != "walnut" {
+		exp, ok := exporters[*to]
+		if !ok {
+			return fmt.Errorf("unknown output format %q", *to)
+		}
+		if out, warnings, err = exp(conf); err != nil {
+			return err
+		}
+		report(warnings)
+	}
+
+	if _, err := os.Stdout.Write(out); err != nil {
+		return err
+	}
+
+	// make sure output ends with a newline
+	if len(out) > 0 && out[len(out)-1] != '\n' {
+		fmt.Println()
+	}
+
+	return nil
+}
+
+// Prints conversion warnings to stderr.
+func report(warnings []walnut.Warning) {
+	for _, w := range warnings {
+		fmt.Fprintf(os.Stderr, "warning: %s\n", w)
+	}
+}
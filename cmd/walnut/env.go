@@ -0,0 +1,39 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/wub/walnut"
+)
+
+func env(args []string) error {
+	fs := flag.NewFlagSet("env", flag.ExitOnError)
+	prefix := fs.String("prefix", "", "prefix for every variable name")
+	dotenv := fs.Bool("dotenv", false, "write a .env file rather than a shell script")
+	reveal := fs.Bool("reveal-secrets", false, "write the values of secrets")
+	r := addReadFlags(fs)
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		return fmt.Errorf("expected exactly one file")
+	}
+
+	in, err := ioutil.ReadFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	conf, err := r.read(in)
+	if err != nil {
+		return err
+	}
+
+	return walnut.WriteEnv(os.Stdout, conf, &walnut.EnvOptions{
+		Prefix:        *prefix,
+		Dotenv:        *dotenv,
+		RevealSecrets: *reveal,
+	})
+}
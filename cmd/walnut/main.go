@@ -0,0 +1,65 @@
+// Command walnut provides tools for working with walnut configuration files.
+//
+//     walnut convert [-from format] [-to format] [read flags] [file]
+//
+// Converts a file (or stdin) between walnut and JSON, TOML, YAML or INI,
+// writing the result to stdout. Values which can't be converted without loss
+// are reported on stderr. Unless given explicitly, the input format is guessed
+// from the file's extension, and the output format defaults to walnut for
+// foreign input, and to JSON for walnut input.
+//
+//     walnut env [-prefix prefix] [-dotenv] [-reveal-secrets] [read flags] file
+//
+// Writes a file's keys as environment variables, "http.port" becoming
+// HTTP_PORT. The output is a shell script exporting each variable, or a .env
+// file with -dotenv. Secrets are rejected unless -reveal-secrets is given.
+//
+// Both commands read walnut source with the same flags: -var name=value sets
+// a variable tested by conditional blocks, and may be repeated, while
+// -secrets dir resolves secret references from files in dir, as by
+// walnut.FileSecrets. Without -secrets, any secret reference is an error.
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+)
+
+var commands = map[string]func(args []string) error{
+	"convert": convert,
+	"env":     env,
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		usage()
+	}
+
+	if err := cmd(os.Args[2:]); err != nil {
+		fmt.Fprintf(os.Stderr, "walnut %s: %s\n", os.Args[1], err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	names := make([]string, 0, len(commands))
+	for name, _ := range commands {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	fmt.Fprintf(os.Stderr, "usage: walnut <command> [arguments]\n\n")
+	fmt.Fprintf(os.Stderr, "commands:\n")
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "    %s\n", name)
+	}
+
+	os.Exit(2)
+}
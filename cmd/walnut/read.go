@@ -0,0 +1,54 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/wub/walnut"
+)
+
+// Options for reading walnut source, shared by all commands.
+type readFlags struct {
+	secrets string
+	vars    vars
+}
+
+// Registers the -secrets and -var flags.
+func addReadFlags(fs *flag.FlagSet) *readFlags {
+	r := &readFlags{vars: make(vars)}
+	fs.StringVar(&r.secrets, "secrets", "", "directory to read secrets from")
+	fs.Var(r.vars, "var", "variable for conditional blocks, as name=value (repeatable)")
+	return r
+}
+
+// Reads walnut source with the options given by the flags.
+func (r *readFlags) read(src []byte) (walnut.Config, error) {
+	opts := &walnut.ReadOptions{Vars: r.vars}
+	if r.secrets != "" {
+		opts.Secrets = walnut.FileSecrets(r.secrets)
+	}
+
+	conf, _, err := walnut.ReadWith(src, opts)
+	return conf, err
+}
+
+// A flag.Value collecting name=value pairs.
+type vars map[string]string
+
+func (v vars) String() string {
+	pairs := make([]string, 0, len(v))
+	for name, value := range v {
+		pairs = append(pairs, name+"="+value)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (v vars) Set(s string) error {
+	name, value, ok := strings.Cut(s, "=")
+	if !ok || name == "" {
+		return fmt.Errorf("expected name=value")
+	}
+	v[name] = value
+	return nil
+}
@@ -0,0 +1,86 @@
+package walnut
+
+import (
+	"reflect"
+	"time"
+)
+
+const errLossy = "%q cannot be converted to %s without loss (is %s)"
+
+var (
+	int64Type    = reflect.TypeOf(int64(0))
+	float64Type  = reflect.TypeOf(float64(0))
+	durationType = reflect.TypeOf(time.Duration(0))
+)
+
+// Returns a view of a Config whose typed accessors, as well as Value and
+// MustValue, convert values of the wrong type where that's possible without
+// losing information:
+//
+//     int64 -> float64         if the float holds the integer exactly
+//     float64 -> int64         if the float is a whole number in range
+//     time.Duration <-> int64  as a number of nanoseconds
+//     string -> any type       if the string holds a literal of that type,
+//                              e.g. "30s" for a duration, other than a
+//                              secret reference or null
+//
+// Lossy conversions, such as 0.5 to an integer, fail with an error rather
+// than the usual one about the value's type. Configs not created by this
+// package are returned as they are.
+func Lenient(conf Config) Config {
+	c, ok := conf.(*config)
+	if !ok {
+		return conf
+	}
+
+	lenient := *c
+	lenient.lenient = true
+
+	return &lenient
+}
+
+// Converts a value to another type for a lenient Config. The second return
+// value reports whether values of v's type can be converted to want at all,
+// the third whether this particular value could be converted without loss.
+func coerce(v interface{}, want reflect.Type) (interface{}, bool, bool) {
+	switch v := v.(type) {
+	case int64:
+		switch want {
+		case float64Type:
+			f := float64(v)
+			return f, true, f < 1<<63 && int64(f) == v
+		case durationType:
+			return time.Duration(v), true, true
+		}
+	case float64:
+		if want == int64Type {
+			if v >= -1<<63 && v < 1<<63 && v == float64(int64(v)) {
+				return int64(v), true, true
+			}
+			return nil, true, false
+		}
+	case time.Duration:
+		if want == int64Type {
+			return int64(v), true, true
+		}
+	case string:
+		parsed, ok := parseLiteral(v)
+		if !ok {
+			break
+		}
+
+		// a string never holds another string, a secret reference or null
+		switch parsed.(type) {
+		case string, Secret, Null:
+			return nil, false, false
+		}
+
+		if reflect.TypeOf(parsed) == want {
+			return parsed, true, true
+		}
+		// e.g. "1" for a float
+		return coerce(parsed, want)
+	}
+
+	return nil, false, false
+}
@@ -0,0 +1,97 @@
+package walnut
+
+import (
+	"fmt"
+	"math"
+	"testing"
+	"time"
+)
+
+var lenientSample = &config{
+	data: map[string]interface{}{
+		"int":      int64(3),
+		"big":      int64(1<<53 + 1),
+		"float":    float64(2),
+		"half":     float64(0.5),
+		"huge":     float64(1e300),
+		"nan":      math.NaN(),
+		"duration": 1500 * time.Millisecond,
+		"str.int":  "42",
+		"str.dur":  "30s",
+		"str.word": "hello",
+		"str.sec":  `secret("x")`,
+		"str.null": "null",
+		"bool":     true,
+	},
+}
+
+var lenientTests = []struct {
+	key  string
+	get  func(c Config, key string) (interface{}, error)
+	want interface{}
+	err  error
+}{
+	{"int", float64Value, float64(3), nil},
+	{"big", float64Value, nil, fmt.Errorf(errLossy, "big", "float64", "int64")},
+	{"float", int64Value, int64(2), nil},
+	{"half", int64Value, nil, fmt.Errorf(errLossy, "half", "int64", "float64")},
+	{"huge", int64Value, nil, fmt.Errorf(errLossy, "huge", "int64", "float64")},
+	{"nan", int64Value, nil, fmt.Errorf(errLossy, "nan", "int64", "float64")},
+	{"duration", int64Value, int64(1500000000), nil},
+	{"int", durationValue, 3 * time.Nanosecond, nil},
+	{"str.int", int64Value, int64(42), nil},
+	{"str.int", float64Value, float64(42), nil},
+	{"str.dur", durationValue, 30 * time.Second, nil},
+	{"str.dur", int64Value, int64(30 * time.Second), nil},
+	{"str.word", int64Value, nil, fmt.Errorf(errWrongType, "str.word", "string", "int64")},
+	{"str.sec", secretValue, nil, fmt.Errorf(errWrongType, "str.sec", "string", "walnut.Secret")},
+	{"str.null", nullValue, nil, fmt.Errorf(errWrongType, "str.null", "string", "walnut.Null")},
+	{"bool", int64Value, nil, fmt.Errorf(errWrongType, "bool", "bool", "int64")},
+	{"int", boolValue, nil, fmt.Errorf(errWrongType, "int", "int64", "bool")},
+}
+
+func int64Value(c Config, key string) (interface{}, error)    { return Value[int64](c, key) }
+func float64Value(c Config, key string) (interface{}, error)  { return Value[float64](c, key) }
+func durationValue(c Config, key string) (interface{}, error) { return Value[time.Duration](c, key) }
+func boolValue(c Config, key string) (interface{}, error)     { return Value[bool](c, key) }
+func secretValue(c Config, key string) (interface{}, error)   { return Value[Secret](c, key) }
+func nullValue(c Config, key string) (interface{}, error)     { return Value[Null](c, key) }
+
+func TestLenient(t *testing.T) {
+	conf := Lenient(lenientSample)
+
+	for _, test := range lenientTests {
+		got, err := test.get(conf, test.key)
+		if err != nil {
+			got = nil
+		}
+
+		if !eq(got, test.want) || !eq(err, test.err) {
+			t.Errorf("lenient Value(%q):", test.key)
+			t.Errorf("   got %#v, %v", got, err)
+			t.Errorf("  want %#v, %v", test.want, test.err)
+		}
+	}
+}
+
+func TestLenientAccessors(t *testing.T) {
+	conf := Lenient(lenientSample)
+
+	if got := conf.Float64("int"); got != 3 {
+		t.Errorf("Config.Float64(%q): got %v, want 3", "int", got)
+	}
+	if got := conf.Select("str").Duration("dur"); got != 30*time.Second {
+		t.Errorf("Config.Select(%q).Duration(%q): got %v, want 30s", "str", "dur", got)
+	}
+
+	func() {
+		defer shouldPanic(t, "Config.Int64", "half", fmt.Errorf(errLossy, "half", "int64", "float64"))
+		conf.Int64("half")
+	}()
+
+	// the original Config stays strict
+	func() {
+		defer shouldPanic(t, "Config.Float64", "int", fmt.Errorf(errWrongType, "int", "int64", "float64"))
+		lenientSample.Float64("int")
+	}()
+}
@@ -0,0 +1,187 @@
+package walnut
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	errDirective = "illegal directive on line %d"
+	errVariable  = "undefined variable %q on line %d"
+)
+
+var reVariable = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*`)
+
+// The names of the directives making up a conditional block.
+var directives = []string{"@if", "@elif", "@else"}
+
+// Splits a line into a directive's name and its argument. The name is empty
+// if the line isn't a directive.
+func selectDirective(content string) (string, string) {
+	for _, name := range directives {
+		rest, ok := strings.CutPrefix(content, name)
+		if ok && (rest == "" || rest[0] == '#' || strings.ContainsRune(Space, rune(rest[0]))) {
+			return name, rest
+		}
+	}
+	return "", content
+}
+
+// The condition of an @if or @elif directive: either the name of a variable,
+// which holds if the variable is defined, or a comparison of a variable with
+// a string, e.g. `env == "prod"`.
+type condition struct {
+	name  string
+	op    string // "==", "!=", or empty for a bare name
+	value string
+}
+
+// Parses a directive's condition. Returns false if it's malformed.
+func parseCondition(in string) (condition, bool) {
+	_, in = selectSpace(in)
+
+	name := reVariable.FindString(in)
+	if name == "" {
+		return condition{}, false
+	}
+
+	_, rest := selectSpace(in[len(name):])
+	if isEmpty(rest) {
+		return condition{name: name}, true
+	}
+
+	if !strings.HasPrefix(rest, "==") && !strings.HasPrefix(rest, "!=") {
+		return condition{}, false
+	}
+	op := rest[:2]
+
+	_, rest = selectSpace(rest[2:])
+	value, n := readString(rest)
+	if n == 0 || !isEmpty(rest[n:]) {
+		return condition{}, false
+	}
+
+	return condition{name, op, value}, true
+}
+
+// Evaluates the condition against a set of variables. The second return
+// value is false if the condition compares an undefined variable.
+func (c condition) eval(vars map[string]string) (bool, bool) {
+	v, ok := vars[c.name]
+
+	switch c.op {
+	case "==":
+		return ok && v == c.value, ok
+	case "!=":
+		return ok && v != c.value, ok
+	}
+
+	return ok, true
+}
+
+// An @if directive, along with any @elif and @else directives following it.
+type branch struct {
+	depth  int  // of the directives
+	taken  bool // one of the bodies has been selected
+	active bool // the current body is selected
+	closed bool // the chain has ended with an @else
+}
+
+// Evaluates conditional blocks, keeping only the lines of the selected
+// bodies. The directives themselves are dropped, and the lines of each
+// selected body are moved up to the directive's depth, so that a body
+// defines its keys as though it wasn't nested. Conditions are only evaluated
+// where they can affect the outcome, so variables used by bodies which
+// aren't selected needn't be defined.
+func selectBranches(lines []line, vars map[string]string) ([]line, error) {
+	output := make([]line, 0, len(lines))
+	stack := make([]branch, 0)
+
+	for _, l := range lines {
+		name, arg := selectDirective(l.content)
+
+		// close the chains which this line isn't a part of
+		for len(stack) > 0 {
+			top := stack[len(stack)-1]
+			continues := name == "@elif" || name == "@else"
+			if top.depth < l.depth || top.depth == l.depth && continues && !top.closed {
+				break
+			}
+			stack = stack[:len(stack)-1]
+		}
+
+		switch name {
+		case "@if":
+			enabled := isActive(stack)
+
+			selected, err := evalDirective(l.index, arg, vars, enabled)
+			if err != nil {
+				return nil, err
+			}
+
+			stack = append(stack, branch{l.depth, selected || !enabled, selected, false})
+
+		case "@elif":
+			if len(stack) == 0 || stack[len(stack)-1].depth != l.depth {
+				return nil, fmt.Errorf(errDirective, l.index)
+			}
+			b := &stack[len(stack)-1]
+
+			selected, err := evalDirective(l.index, arg, vars, !b.taken)
+			if err != nil {
+				return nil, err
+			}
+
+			b.active = selected
+			b.taken = b.taken || selected
+
+		case "@else":
+			if len(stack) == 0 || stack[len(stack)-1].depth != l.depth || !isEmpty(arg) {
+				return nil, fmt.Errorf(errDirective, l.index)
+			}
+			b := &stack[len(stack)-1]
+
+			b.active = !b.taken
+			b.taken = true
+			b.closed = true
+
+		default:
+			if isActive(stack) {
+				l.depth -= len(stack)
+				output = append(output, l)
+			}
+		}
+	}
+
+	return output, nil
+}
+
+// Parses a directive's condition, and evaluates it if needed. Returns an
+// error if the condition is malformed, or compares an undefined variable.
+func evalDirective(index int, arg string, vars map[string]string, needed bool) (bool, error) {
+	c, ok := parseCondition(arg)
+	if !ok {
+		return false, fmt.Errorf(errDirective, index)
+	}
+	if !needed {
+		return false, nil
+	}
+
+	v, ok := c.eval(vars)
+	if !ok {
+		return false, fmt.Errorf(errVariable, c.name, index)
+	}
+
+	return v, nil
+}
+
+// Returns true if all of the chains' current bodies are selected.
+func isActive(stack []branch) bool {
+	for _, b := range stack {
+		if !b.active {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,159 @@
+package walnut
+
+import (
+	"fmt"
+	"testing"
+)
+
+var parseConditionTests = []struct {
+	in   string
+	want condition
+	ok   bool
+}{
+	{" debug", condition{"debug", "", ""}, true},
+	{" debug # comment", condition{"debug", "", ""}, true},
+	{` env == "prod"`, condition{"env", "==", "prod"}, true},
+	{` env=="prod"`, condition{"env", "==", "prod"}, true},
+	{` env != "dev" # not dev`, condition{"env", "!=", "dev"}, true},
+	{"", condition{}, false},
+	{` env = "prod"`, condition{}, false},
+	{` env == prod`, condition{}, false},
+	{` env == "prod" x`, condition{}, false},
+	{` 1env`, condition{}, false},
+	{` env.name == "x"`, condition{}, false},
+}
+
+func TestParseCondition(t *testing.T) {
+	for _, test := range parseConditionTests {
+		got, ok := parseCondition(test.in)
+		if got != test.want || ok != test.ok {
+			t.Errorf("parseCondition(%q):", test.in)
+			t.Errorf("   got %+v, %v", got, ok)
+			t.Errorf("  want %+v, %v", test.want, test.ok)
+		}
+	}
+}
+
+const conditionalSource = `
+db
+  @if env == "prod"
+    host = "db.internal"
+    pool = 50
+  @elif env == "staging"
+    host = "db.staging"
+    pool = 10
+  @else
+    host = "localhost"
+    pool = 2
+  name = "app"
+@if debug
+  log.level = "debug"
+  @if env != "prod"
+    log.sql = true
+`
+
+var conditionalTests = []struct {
+	vars map[string]string
+	want map[string]interface{}
+}{
+	{
+		map[string]string{"env": "prod"},
+		map[string]interface{}{
+			"db.host": "db.internal",
+			"db.pool": int64(50),
+			"db.name": "app",
+		},
+	},
+	{
+		map[string]string{"env": "staging", "debug": ""},
+		map[string]interface{}{
+			"db.host":   "db.staging",
+			"db.pool":   int64(10),
+			"db.name":   "app",
+			"log.level": "debug",
+			"log.sql":   true,
+		},
+	},
+	{
+		map[string]string{"env": "dev"},
+		map[string]interface{}{
+			"db.host": "localhost",
+			"db.pool": int64(2),
+			"db.name": "app",
+		},
+	},
+}
+
+func TestConditionalBlocks(t *testing.T) {
+	for _, test := range conditionalTests {
+		conf, _, err := ReadWith([]byte(conditionalSource), &ReadOptions{Vars: test.vars})
+		if err != nil {
+			t.Errorf("ReadWith(vars %v): %v", test.vars, err)
+			continue
+		}
+
+		got := make(map[string]interface{})
+		for _, key := range conf.Keys() {
+			got[key], _ = conf.Get(key)
+		}
+
+		if !eq(got, test.want) {
+			t.Errorf("ReadWith(vars %v):", test.vars)
+			t.Errorf("   got %v", got)
+			t.Errorf("  want %v", test.want)
+		}
+	}
+}
+
+var conditionalErrorTests = []struct {
+	in   string
+	vars map[string]string
+	err  error
+}{
+	{"@if env == \"prod\"\n  a = 1", nil, fmt.Errorf(errVariable, "env", 1)},
+	{"@if x\n  a = 1\n@elif env == \"prod\"\n  a = 2", map[string]string{"x": ""}, nil},
+	{"@if x\n  a = 1\n@elif env == \"prod\"\n  a = 2", nil, fmt.Errorf(errVariable, "env", 3)},
+	{"@if x\n  @if env == \"prod\"\n    a = 1", nil, nil},
+	{"@else\n  a = 1", nil, fmt.Errorf(errDirective, 1)},
+	{"@if x\n  a = 1\n@else\n  a = 2\n@else\n  a = 3", nil, fmt.Errorf(errDirective, 5)},
+	{"@if x\n  a = 1\n@else x\n  a = 2", nil, fmt.Errorf(errDirective, 3)},
+	{"@if x\n  a = 1\nb = 2\n@elif y", nil, fmt.Errorf(errDirective, 4)},
+	{"@if\n  a = 1", nil, fmt.Errorf(errDirective, 1)},
+	{"@if x\n  a = 1\n@else\n  a = 2", map[string]string{"x": ""}, nil},
+	{"@if x\n  a = 1\na = 2", map[string]string{"x": ""}, fmt.Errorf(errConflict, "a", 3, "a", 2)},
+}
+
+func TestConditionalErrors(t *testing.T) {
+	for _, test := range conditionalErrorTests {
+		_, _, err := ReadWith([]byte(test.in), &ReadOptions{Vars: test.vars})
+		if !eq(err, test.err) {
+			t.Errorf("ReadWith(%q, vars %v):", test.in, test.vars)
+			t.Errorf("   got %v", err)
+			t.Errorf("  want %v", test.err)
+		}
+	}
+}
+
+func TestParseConditionalBlocks(t *testing.T) {
+	f, err := Parse([]byte(conditionalSource))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	if got := f.Lines[2].Kind(); got != DirectiveLine {
+		t.Errorf("kind of line 3: got %v, want %v", got, DirectiveLine)
+	}
+	if line := f.Lookup("db.pool"); line == nil || line.Literal() != "50" {
+		t.Errorf("File.Lookup(%q): got %v, want the first definition", "db.pool", line)
+	}
+	if line := f.Lookup("log.sql"); line == nil || line.Depth() != 2 {
+		t.Errorf("File.Lookup(%q): got %v, want a line at depth 2", "log.sql", line)
+	}
+	if got := string(f.Bytes()); got != conditionalSource {
+		t.Errorf("File.Bytes(): got %q", got)
+	}
+
+	if _, err := Parse([]byte("@if env = 1")); !eq(err, fmt.Errorf(errDirective, 1)) {
+		t.Errorf("Parse(%q): got %v, want %v", "@if env = 1", err, fmt.Errorf(errDirective, 1))
+	}
+}
@@ -2,6 +2,8 @@ package walnut
 
 import (
 	"fmt"
+	"net/netip"
+	"net/url"
 	"reflect"
 	"sort"
 	"strings"
@@ -18,7 +20,8 @@ type Matcher interface {
 }
 
 type Config interface {
-	// Returns a list of all defined keys, sorted lexographically.
+	// Returns a list of all defined keys, sorted lexographically. Keys
+	// with quoted segments are in the canonical form produced by JoinKey.
 	Keys() []string
 
 	// Returns all keys matching the provided filter, sorted lexographically.
@@ -28,23 +31,113 @@ type Config interface {
 	// the returned Config will be prefixed with the prefix.
 	Select(prefix string) Config
 
+	// Returns the elements of a repeated key group, e.g. one defined with
+	// "upstream[]" lines, in the order they were defined. Each is selected
+	// as by Select, and elements without any keys are included as empty
+	// Configs. Returns an empty slice if the group isn't defined.
+	Sections(key string) []Config
+
 	// Retrieves an untyped value. The second return value will be false
 	// if the value hasn't been defined.
 	Get(key string) (interface{}, bool)
 
+	// Returns the position of the key's definition. The second return
+	// value will be false if the key hasn't been defined, or if its
+	// position is unknown.
+	Position(key string) (Position, bool)
+
+	// Returns the comments documenting a key or key group: the block of
+	// comment lines directly above its definition, followed by the comment
+	// at the end of its line, one per line. Each comment's '#' and a single
+	// space after it are removed. Returns an empty string if the key isn't
+	// documented.
+	Doc(key string) string
+
 	// Retrieves a typed value. Panics if the key doesn't exist, or if its
-	// value is of the wrong type.
+	// value is of the wrong type; see Lenient for converting values.
 	Bool(key string) bool
 	Int64(key string) int64
 	Float64(key string) float64
 	Duration(key string) time.Duration
+	Period(key string) Period
 	Time(key string) time.Time
+	Date(key string) Date
+	TimeOfDay(key string) TimeOfDay
+	Bytes(key string) ByteSize
+	Addr(key string) netip.Addr
+	Prefix(key string) netip.Prefix
+	AddrPort(key string) netip.AddrPort
+	URL(key string) *url.URL
+	Secret(key string) Secret
+}
+
+// Retrieves a value of any type, built in or registered with
+// RegisterLiteral. Returns an error if the key doesn't exist, or if its value
+// isn't a T (and, for a Config returned by Lenient, can't be converted to
+// one); these are the errors the typed accessors of Config panic with.
+func Value[T any](c Config, key string) (T, error) {
+	var zero T
+
+	v, ok := c.Get(key)
+	if !ok {
+		return zero, fmt.Errorf(errUndefined, key)
+	}
+
+	t, ok := v.(T)
+	if ok {
+		return t, nil
+	}
+
+	typ := reflect.TypeOf(v).String()
+	want := reflect.TypeOf((*T)(nil)).Elem()
+
+	if c, ok := c.(*config); ok && c.lenient {
+		if converted, convertible, exact := coerce(v, want); convertible {
+			if !exact {
+				return zero, fmt.Errorf(errLossy, key, want, typ)
+			}
+			return converted.(T), nil
+		}
+	}
+
+	return zero, fmt.Errorf(errWrongType, key, typ, want)
+}
+
+// Like Value, but panics instead of returning an error, like the typed
+// accessors of Config.
+func MustValue[T any](c Config, key string) T {
+	v, err := Value[T](c, key)
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+// Position describes where a key was defined.
+type Position struct {
+	File    string // empty unless the Config was created with Load
+	Line    int    // 1-indexed
+	Column  int    // 1-indexed, in bytes
+	Literal string // the value literal, exactly as written
+}
+
+// Returns the position as "file:line:column", omitting the file name if
+// it's unknown.
+func (p Position) String() string {
+	if p.File == "" {
+		return fmt.Sprintf("%d:%d", p.Line, p.Column)
+	}
+	return fmt.Sprintf("%s:%d:%d", p.File, p.Line, p.Column)
 }
 
 // A simple implementation of the Config interface.
 type config struct {
-	prefix string
-	data   map[string]interface{}
+	prefix    string
+	data      map[string]interface{}
+	positions map[string]Position
+	docs      map[string]string
+	sections  sectionCounter // element counts of repeated key groups
+	lenient   bool           // see Lenient
 }
 
 func (c *config) Keys() []string {
@@ -81,100 +174,121 @@ func (c *config) Match(filter Matcher) []string {
 }
 
 func (c *config) Select(prefix string) Config {
-	return &config{prefix + ".", c.data}
+	return &config{c.prefix + prefix + ".", c.data, c.positions, c.docs, c.sections, c.lenient}
 }
 
-func (c *config) Get(key string) (interface{}, bool) {
-	v, ok := c.data[c.prefix+key]
-	return v, ok
+func (c *config) Doc(key string) string {
+	return c.docs[c.prefix+key]
 }
 
-func (c *config) Bool(key string) bool {
-	v, ok := c.data[c.prefix+key]
-	if !ok {
-		panic(fmt.Errorf(errUndefined, key))
+func (c *config) Sections(key string) []Config {
+	segments := SplitKey(key)
+	parents, name := segments[:len(segments)-1], segments[len(segments)-1]
+	group := JoinKey(parents...)
+
+	// elements without any keys are only counted when parsing; Configs
+	// created otherwise, e.g. by Merge, go by their keys alone
+	count := c.sections[c.prefix+JoinKey(segments...)]
+	for k, _ := range c.data {
+		if !strings.HasPrefix(k, c.prefix) {
+			continue
+		}
+
+		// the key must continue past the element's segment
+		s := SplitKey(k[len(c.prefix):])
+		if len(s) < len(segments)+1 || JoinKey(s[:len(parents)]...) != group {
+			continue
+		}
+
+		if i := sectionIndex(s[len(parents)], name); i >= count {
+			count = i + 1
+		}
 	}
 
-	b, ok := v.(bool)
-	if !ok {
-		typ := reflect.TypeOf(v).String()
-		panic(fmt.Errorf(errWrongType, key, typ, "bool"))
+	sections := make([]Config, count)
+	for i := range sections {
+		element := append(parents[:len(parents):len(parents)], sectionSegment(name, i))
+		sections[i] = c.Select(JoinKey(element...))
 	}
 
-	return b
+	return sections
 }
 
-func (c *config) Int64(key string) int64 {
+func (c *config) Get(key string) (interface{}, bool) {
 	v, ok := c.data[c.prefix+key]
-	if !ok {
-		panic(fmt.Errorf(errUndefined, key))
-	}
+	return v, ok
+}
 
-	i, ok := v.(int64)
-	if !ok {
-		typ := reflect.TypeOf(v).String()
-		panic(fmt.Errorf(errWrongType, key, typ, "int64"))
-	}
+func (c *config) Position(key string) (Position, bool) {
+	p, ok := c.positions[c.prefix+key]
+	return p, ok
+}
 
-	return i
+func (c *config) Bool(key string) bool {
+	return MustValue[bool](c, key)
+}
+
+func (c *config) Int64(key string) int64 {
+	return MustValue[int64](c, key)
 }
 
 func (c *config) Float64(key string) float64 {
-	v, ok := c.data[c.prefix+key]
-	if !ok {
-		panic(fmt.Errorf(errUndefined, key))
-	}
+	return MustValue[float64](c, key)
+}
 
-	f, ok := v.(float64)
-	if !ok {
-		typ := reflect.TypeOf(v).String()
-		panic(fmt.Errorf(errWrongType, key, typ, "float64"))
-	}
+func (c *config) String(key string) string {
+	return MustValue[string](c, key)
+}
 
-	return f
+func (c *config) Time(key string) time.Time {
+	return MustValue[time.Time](c, key)
 }
 
-func (c *config) String(key string) string {
-	v, ok := c.data[c.prefix+key]
-	if !ok {
-		panic(fmt.Errorf(errUndefined, key))
-	}
+func (c *config) Duration(key string) time.Duration {
+	return MustValue[time.Duration](c, key)
+}
 
-	s, ok := v.(string)
-	if !ok {
-		typ := reflect.TypeOf(v).String()
-		panic(fmt.Errorf(errWrongType, key, typ, "string"))
-	}
+func (c *config) Period(key string) Period {
+	return MustValue[Period](c, key)
+}
 
-	return s
+func (c *config) Date(key string) Date {
+	return MustValue[Date](c, key)
 }
 
-func (c *config) Time(key string) time.Time {
-	v, ok := c.data[c.prefix+key]
-	if !ok {
-		panic(fmt.Errorf(errUndefined, key))
-	}
+func (c *config) TimeOfDay(key string) TimeOfDay {
+	return MustValue[TimeOfDay](c, key)
+}
 
-	t, ok := v.(time.Time)
-	if !ok {
-		typ := reflect.TypeOf(v).String()
-		panic(fmt.Errorf(errWrongType, key, typ, "time.Time"))
-	}
+func (c *config) Bytes(key string) ByteSize {
+	return MustValue[ByteSize](c, key)
+}
 
-	return t
+func (c *config) Addr(key string) netip.Addr {
+	return MustValue[netip.Addr](c, key)
 }
 
-func (c *config) Duration(key string) time.Duration {
-	v, ok := c.data[c.prefix+key]
-	if !ok {
-		panic(fmt.Errorf(errUndefined, key))
-	}
+func (c *config) Prefix(key string) netip.Prefix {
+	return MustValue[netip.Prefix](c, key)
+}
 
-	d, ok := v.(time.Duration)
-	if !ok {
-		typ := reflect.TypeOf(v).String()
-		panic(fmt.Errorf(errWrongType, key, typ, "time.Duration"))
+func (c *config) AddrPort(key string) netip.AddrPort {
+	return MustValue[netip.AddrPort](c, key)
+}
+
+// Returns a copy of the URL, so callers can't modify the Config's value.
+func (c *config) URL(key string) *url.URL {
+	u := MustValue[*url.URL](c, key)
+
+	copy := *u
+	if u.User != nil {
+		user := *u.User
+		copy.User = &user
 	}
 
-	return d
+	return &copy
+}
+
+func (c *config) Secret(key string) Secret {
+	return MustValue[Secret](c, key)
 }
@@ -2,20 +2,32 @@ package walnut
 
 import (
 	"fmt"
+	"io/ioutil"
+	"net/netip"
+	"net/url"
+	"path/filepath"
 	"regexp"
 	"testing"
 	"time"
 )
 
 var sample = &config{
-	"",
-	map[string]interface{}{
+	data: map[string]interface{}{
 		"string":   "hello",
 		"bool":     true,
 		"int64":    int64(12345),
 		"float64":  float64(123.45),
 		"time":     time.Date(2012, 12, 28, 15, 10, 15, 0, time.UTC),
 		"duration": 2 * time.Second,
+		"bytes":    ByteSize(64 << 10),
+		"period":   Period{1, 6, 0},
+		"date":     Date{2012, time.December, 28},
+		"clock":    TimeOfDay{15, 10, 15, 0},
+		"addr":     netip.MustParseAddr("10.0.0.1"),
+		"prefix":   netip.MustParsePrefix("10.0.0.0/8"),
+		"addrport": netip.MustParseAddrPort("10.0.0.1:80"),
+		"url":      &url.URL{Scheme: "https", Host: "example.com", Path: "/"},
+		"secret":   Secret{"db/password", "hunter2"},
 		"foo.def":  "hello",
 		"foo.abc":  "bye",
 	},
@@ -37,17 +49,44 @@ func TestConfigSelect(t *testing.T) {
 	}
 }
 
+func TestConfigSelectNested(t *testing.T) {
+	conf, err := Read([]byte("a\n  b\n    c = 1\n  d = 2\nb\n  c = 3"))
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+
+	sub := conf.Select("a").Select("b")
+	if v, _ := sub.Get("c"); v != int64(1) {
+		t.Errorf(`Config.Select("a").Select("b").Get("c"): got %v, want 1`, v)
+	}
+	if got := sub.Keys(); !eq(got, []string{"c"}) {
+		t.Errorf(`Config.Select("a").Select("b").Keys(): got %v, want [c]`, got)
+	}
+	if p, _ := sub.Position("c"); p.Line != 3 {
+		t.Errorf(`Config.Select("a").Select("b").Position("c"): got line %d, want 3`, p.Line)
+	}
+}
+
 func TestConfigKeys(t *testing.T) {
 	got := sample.Keys()
 	want := []string{
+		"addr",
+		"addrport",
 		"bool",
+		"bytes",
+		"clock",
+		"date",
 		"duration",
 		"float64",
 		"foo.abc",
 		"foo.def",
 		"int64",
+		"period",
+		"prefix",
+		"secret",
 		"string",
 		"time",
+		"url",
 	}
 
 	if !eq(got, want) {
@@ -68,6 +107,20 @@ func TestConfigMatch(t *testing.T) {
 	}
 }
 
+func TestConfigGetNull(t *testing.T) {
+	conf, err := Read([]byte("a = null"))
+	if err != nil {
+		t.Fatalf("Read(%q): %v", "a = null", err)
+	}
+
+	got, ok := conf.Get("a")
+	if got != (Null{}) || ok != true {
+		t.Errorf("Config.Get(\"a\"):")
+		t.Errorf("   got %#v, %#v", got, ok)
+		t.Errorf("  want %#v, %#v", Null{}, true)
+	}
+}
+
 func TestConfigGet(t *testing.T) {
 	got, ok := sample.Get("undefined")
 	if got != nil || ok != false {
@@ -86,6 +139,89 @@ func TestConfigGet(t *testing.T) {
 	}
 }
 
+func TestConfigInlineMap(t *testing.T) {
+	conf, err := Read([]byte("limits = {read = 10, write = {burst = 5}}"))
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+
+	sub := conf.Select("limits")
+	if got := sub.Keys(); !eq(got, []string{"read", "write.burst"}) {
+		t.Errorf("Config.Select(\"limits\").Keys():")
+		t.Errorf("   got %v", got)
+		t.Errorf("  want %v", []string{"read", "write.burst"})
+	}
+
+	src := "limits = {read = 10}\nlimits\n  read = 5"
+	want := fmt.Errorf(errConflict, "limits.read", 3, "limits.read", 1)
+	if _, err := Read([]byte(src)); !eq(err, want) {
+		t.Errorf("Read(%q):", src)
+		t.Errorf("   got %v", err)
+		t.Errorf("  want %v", want)
+	}
+}
+
+var positionTests = []struct {
+	key  string
+	want Position
+	ok   bool
+}{
+	{"undefined", Position{}, false},
+	{"http", Position{}, false},
+	{"http.host", Position{"conf.wn", 3, 3, `"localhost"`}, true},
+	{"http.port", Position{"conf.wn", 4, 3, "8080"}, true},
+	{"cookie.ttl", Position{"conf.wn", 6, 1, "48h 30m"}, true},
+}
+
+func TestConfigPosition(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "conf.wn")
+	src := "# comment\nhttp\n  host = \"localhost\" # comment\n  port = 8080\n\ncookie.ttl = 48h 30m\n"
+
+	if err := ioutil.WriteFile(path, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	conf := Load(path)
+
+	for _, test := range positionTests {
+		got, ok := conf.Position(test.key)
+		if ok {
+			got.File = filepath.Base(got.File)
+		}
+
+		if got != test.want || ok != test.ok {
+			t.Errorf("Config.Position(%q):", test.key)
+			t.Errorf("   got %#v, %v", got, ok)
+			t.Errorf("  want %#v, %v", test.want, test.ok)
+		}
+	}
+
+	got, _ := conf.Select("http").Position("port")
+	if got.Line != 4 {
+		t.Errorf("Config.Select(\"http\").Position(\"port\"):")
+		t.Errorf("   got %#v", got)
+		t.Errorf("  want line 4")
+	}
+}
+
+var positionStringTests = []struct {
+	in   Position
+	want string
+}{
+	{Position{"", 12, 3, "1"}, "12:3"},
+	{Position{"conf.wn", 12, 3, "1"}, "conf.wn:12:3"},
+}
+
+func TestPositionString(t *testing.T) {
+	for _, test := range positionStringTests {
+		if got := test.in.String(); got != test.want {
+			t.Errorf("%#v.String():", test.in)
+			t.Errorf("   got %q", got)
+			t.Errorf("  want %q", test.want)
+		}
+	}
+}
+
 var boolTests = []struct {
 	key  string
 	want bool
@@ -98,6 +234,7 @@ var boolTests = []struct {
 	{"float64", false, fmt.Errorf(errWrongType, "float64", "float64", "bool")},
 	{"time", false, fmt.Errorf(errWrongType, "time", "time.Time", "bool")},
 	{"duration", false, fmt.Errorf(errWrongType, "duration", "time.Duration", "bool")},
+	{"bytes", false, fmt.Errorf(errWrongType, "bytes", "walnut.ByteSize", "bool")},
 }
 
 func TestConfigBool(t *testing.T) {
@@ -125,6 +262,7 @@ var int64Tests = []struct {
 	{"float64", 0, fmt.Errorf(errWrongType, "float64", "float64", "int64")},
 	{"time", 0, fmt.Errorf(errWrongType, "time", "time.Time", "int64")},
 	{"duration", 0, fmt.Errorf(errWrongType, "duration", "time.Duration", "int64")},
+	{"bytes", 0, fmt.Errorf(errWrongType, "bytes", "walnut.ByteSize", "int64")},
 }
 
 func TestConfigInt64(t *testing.T) {
@@ -206,6 +344,7 @@ var timeTests = []struct {
 	{"float64", time.Time{}, fmt.Errorf(errWrongType, "float64", "float64", "time.Time")},
 	{"time", time.Date(2012, 12, 28, 15, 10, 15, 0, time.UTC), nil},
 	{"duration", time.Time{}, fmt.Errorf(errWrongType, "duration", "time.Duration", "time.Time")},
+	{"date", time.Time{}, fmt.Errorf(errWrongType, "date", "walnut.Date", "time.Time")},
 }
 
 func TestConfigTime(t *testing.T) {
@@ -233,6 +372,7 @@ var durationTests = []struct {
 	{"float64", 0, fmt.Errorf(errWrongType, "float64", "float64", "time.Duration")},
 	{"time", 0, fmt.Errorf(errWrongType, "time", "time.Time", "time.Duration")},
 	{"duration", 2 * time.Second, nil},
+	{"bytes", 0, fmt.Errorf(errWrongType, "bytes", "walnut.ByteSize", "time.Duration")},
 }
 
 func TestConfigDuration(t *testing.T) {
@@ -248,6 +388,257 @@ func TestConfigDuration(t *testing.T) {
 	}
 }
 
+var periodTests = []struct {
+	key  string
+	want Period
+	err  error
+}{
+	{"undefined", Period{}, fmt.Errorf(errUndefined, "undefined")},
+	{"string", Period{}, fmt.Errorf(errWrongType, "string", "string", "walnut.Period")},
+	{"duration", Period{}, fmt.Errorf(errWrongType, "duration", "time.Duration", "walnut.Period")},
+	{"period", Period{1, 6, 0}, nil},
+}
+
+func TestConfigPeriod(t *testing.T) {
+	for _, test := range periodTests {
+		func() {
+			defer shouldPanic(t, "Config.Period", test.key, test.err)
+			if got := sample.Period(test.key); got != test.want {
+				t.Errorf("Config.Period(%q):", test.key)
+				t.Errorf("   got %#v", got)
+				t.Errorf("  want %#v", test.want)
+			}
+		}()
+	}
+}
+
+var dateTests = []struct {
+	key  string
+	want Date
+	err  error
+}{
+	{"undefined", Date{}, fmt.Errorf(errUndefined, "undefined")},
+	{"string", Date{}, fmt.Errorf(errWrongType, "string", "string", "walnut.Date")},
+	{"time", Date{}, fmt.Errorf(errWrongType, "time", "time.Time", "walnut.Date")},
+	{"clock", Date{}, fmt.Errorf(errWrongType, "clock", "walnut.TimeOfDay", "walnut.Date")},
+	{"date", Date{2012, time.December, 28}, nil},
+}
+
+func TestConfigDate(t *testing.T) {
+	for _, test := range dateTests {
+		func() {
+			defer shouldPanic(t, "Config.Date", test.key, test.err)
+			if got := sample.Date(test.key); got != test.want {
+				t.Errorf("Config.Date(%q):", test.key)
+				t.Errorf("   got %#v", got)
+				t.Errorf("  want %#v", test.want)
+			}
+		}()
+	}
+}
+
+var timeOfDayTests = []struct {
+	key  string
+	want TimeOfDay
+	err  error
+}{
+	{"undefined", TimeOfDay{}, fmt.Errorf(errUndefined, "undefined")},
+	{"string", TimeOfDay{}, fmt.Errorf(errWrongType, "string", "string", "walnut.TimeOfDay")},
+	{"time", TimeOfDay{}, fmt.Errorf(errWrongType, "time", "time.Time", "walnut.TimeOfDay")},
+	{"date", TimeOfDay{}, fmt.Errorf(errWrongType, "date", "walnut.Date", "walnut.TimeOfDay")},
+	{"clock", TimeOfDay{15, 10, 15, 0}, nil},
+}
+
+func TestConfigTimeOfDay(t *testing.T) {
+	for _, test := range timeOfDayTests {
+		func() {
+			defer shouldPanic(t, "Config.TimeOfDay", test.key, test.err)
+			if got := sample.TimeOfDay(test.key); got != test.want {
+				t.Errorf("Config.TimeOfDay(%q):", test.key)
+				t.Errorf("   got %#v", got)
+				t.Errorf("  want %#v", test.want)
+			}
+		}()
+	}
+}
+
+var bytesTests = []struct {
+	key  string
+	want ByteSize
+	err  error
+}{
+	{"undefined", 0, fmt.Errorf(errUndefined, "undefined")},
+	{"string", 0, fmt.Errorf(errWrongType, "string", "string", "walnut.ByteSize")},
+	{"int64", 0, fmt.Errorf(errWrongType, "int64", "int64", "walnut.ByteSize")},
+	{"duration", 0, fmt.Errorf(errWrongType, "duration", "time.Duration", "walnut.ByteSize")},
+	{"bytes", 64 << 10, nil},
+}
+
+func TestConfigBytes(t *testing.T) {
+	for _, test := range bytesTests {
+		func() {
+			defer shouldPanic(t, "Config.Bytes", test.key, test.err)
+			if got := sample.Bytes(test.key); got != test.want {
+				t.Errorf("Config.Bytes(%q):", test.key)
+				t.Errorf("   got %#v", got)
+				t.Errorf("  want %#v", test.want)
+			}
+		}()
+	}
+}
+
+var addrTests = []struct {
+	key  string
+	want netip.Addr
+	err  error
+}{
+	{"undefined", netip.Addr{}, fmt.Errorf(errUndefined, "undefined")},
+	{"string", netip.Addr{}, fmt.Errorf(errWrongType, "string", "string", "netip.Addr")},
+	{"prefix", netip.Addr{}, fmt.Errorf(errWrongType, "prefix", "netip.Prefix", "netip.Addr")},
+	{"addr", netip.MustParseAddr("10.0.0.1"), nil},
+}
+
+func TestConfigAddr(t *testing.T) {
+	for _, test := range addrTests {
+		func() {
+			defer shouldPanic(t, "Config.Addr", test.key, test.err)
+			if got := sample.Addr(test.key); got != test.want {
+				t.Errorf("Config.Addr(%q):", test.key)
+				t.Errorf("   got %#v", got)
+				t.Errorf("  want %#v", test.want)
+			}
+		}()
+	}
+}
+
+var prefixTests = []struct {
+	key  string
+	want netip.Prefix
+	err  error
+}{
+	{"undefined", netip.Prefix{}, fmt.Errorf(errUndefined, "undefined")},
+	{"addr", netip.Prefix{}, fmt.Errorf(errWrongType, "addr", "netip.Addr", "netip.Prefix")},
+	{"prefix", netip.MustParsePrefix("10.0.0.0/8"), nil},
+}
+
+func TestConfigPrefix(t *testing.T) {
+	for _, test := range prefixTests {
+		func() {
+			defer shouldPanic(t, "Config.Prefix", test.key, test.err)
+			if got := sample.Prefix(test.key); got != test.want {
+				t.Errorf("Config.Prefix(%q):", test.key)
+				t.Errorf("   got %#v", got)
+				t.Errorf("  want %#v", test.want)
+			}
+		}()
+	}
+}
+
+var addrPortTests = []struct {
+	key  string
+	want netip.AddrPort
+	err  error
+}{
+	{"undefined", netip.AddrPort{}, fmt.Errorf(errUndefined, "undefined")},
+	{"addr", netip.AddrPort{}, fmt.Errorf(errWrongType, "addr", "netip.Addr", "netip.AddrPort")},
+	{"addrport", netip.MustParseAddrPort("10.0.0.1:80"), nil},
+}
+
+func TestConfigAddrPort(t *testing.T) {
+	for _, test := range addrPortTests {
+		func() {
+			defer shouldPanic(t, "Config.AddrPort", test.key, test.err)
+			if got := sample.AddrPort(test.key); got != test.want {
+				t.Errorf("Config.AddrPort(%q):", test.key)
+				t.Errorf("   got %#v", got)
+				t.Errorf("  want %#v", test.want)
+			}
+		}()
+	}
+}
+
+var urlTests = []struct {
+	key  string
+	want string
+	err  error
+}{
+	{"undefined", "", fmt.Errorf(errUndefined, "undefined")},
+	{"string", "", fmt.Errorf(errWrongType, "string", "string", "*url.URL")},
+	{"url", "https://example.com/", nil},
+}
+
+func TestConfigURL(t *testing.T) {
+	for _, test := range urlTests {
+		func() {
+			defer shouldPanic(t, "Config.URL", test.key, test.err)
+			if got := sample.URL(test.key); got.String() != test.want {
+				t.Errorf("Config.URL(%q):", test.key)
+				t.Errorf("   got %v", got)
+				t.Errorf("  want %v", test.want)
+			}
+		}()
+	}
+}
+
+var secretTests = []struct {
+	key  string
+	want Secret
+	err  error
+}{
+	{"undefined", Secret{}, fmt.Errorf(errUndefined, "undefined")},
+	{"string", Secret{}, fmt.Errorf(errWrongType, "string", "string", "walnut.Secret")},
+	{"secret", Secret{"db/password", "hunter2"}, nil},
+}
+
+func TestConfigSecret(t *testing.T) {
+	for _, test := range secretTests {
+		func() {
+			defer shouldPanic(t, "Config.Secret", test.key, test.err)
+			if got := sample.Secret(test.key); got != test.want {
+				t.Errorf("Config.Secret(%q):", test.key)
+				t.Errorf("   got %v", got)
+				t.Errorf("  want %v", test.want)
+			}
+		}()
+	}
+}
+
+func TestConfigURLCopy(t *testing.T) {
+	sample.URL("url").Path = "/changed"
+
+	if got := sample.URL("url").Path; got != "/" {
+		t.Errorf("Config.URL returned a shared URL, path changed to %q", got)
+	}
+}
+
+func TestValueBuiltin(t *testing.T) {
+	if got, err := Value[Period](sample, "period"); got != (Period{1, 6, 0}) || err != nil {
+		t.Errorf("Value[Period](%q): got %v, %v", "period", got, err)
+	}
+	if got, err := Value[netip.Addr](sample.Select("foo"), "def"); !eq(err, fmt.Errorf(errWrongType, "def", "string", "netip.Addr")) {
+		t.Errorf("Value[netip.Addr](%q): got %v, %v", "foo.def", got, err)
+	}
+	if _, err := Value[bool](sample, "undefined"); !eq(err, fmt.Errorf(errUndefined, "undefined")) {
+		t.Errorf("Value[bool](%q): got %v", "undefined", err)
+	}
+
+	// values may be retrieved as any interface they implement
+	if got, err := Value[fmt.Stringer](sample, "bytes"); err != nil || got.String() != "64KiB" {
+		t.Errorf("Value[fmt.Stringer](%q): got %v, %v", "bytes", got, err)
+	}
+}
+
+func TestMustValue(t *testing.T) {
+	if got := MustValue[time.Duration](sample, "duration"); got != 2*time.Second {
+		t.Errorf("MustValue[time.Duration](%q): got %v", "duration", got)
+	}
+
+	func() {
+		defer shouldPanic(t, "MustValue[int64]", "float64", fmt.Errorf(errWrongType, "float64", "float64", "int64"))
+		MustValue[int64](sample, "float64")
+	}()
+}
+
 func shouldPanic(t *testing.T, method, key string, want error) {
 	r := recover()
 	switch {
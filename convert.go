@@ -0,0 +1,116 @@
+package walnut
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	errImportKey      = "%q is not a valid walnut key"
+	errImportConflict = "key %q collides with %q"
+)
+
+// A Warning describes a possible problem which isn't an error: a value
+// which could not be converted between walnut and another format without
+// losing information, or an assignment overridden by a later one, as
+// reported by ReadWith, LoadWith and File.ConfigWith.
+type Warning struct {
+	Key     string
+	Message string
+}
+
+func (w Warning) String() string {
+	return fmt.Sprintf("%s: %s", w.Key, w.Message)
+}
+
+// Generates walnut source from a table of (key -> literal) pairs. Returns an
+// error if any two keys collide.
+func writeTable(table map[string]string) ([]byte, error) {
+	keys := make([]string, 0, len(table))
+	for key, _ := range table {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	// since keys are sorted, a key's children will immediately follow it
+	for i := 1; i < len(keys); i++ {
+		if conflicts(keys[i], keys[i-1]) {
+			return nil, fmt.Errorf(errImportConflict, keys[i], keys[i-1])
+		}
+	}
+
+	literals := make([]string, len(keys))
+	for i, key := range keys {
+		literals[i] = table[key]
+	}
+
+	return writeTree(keys, literals), nil
+}
+
+// Converts a string from a foreign format to a walnut literal. Strings
+// holding a walnut duration, period, byte size, timestamp, date, time of
+// day, network address or URL, or a literal of a type registered with
+// RegisterLiteral, are converted to those types rather than quoted.
+//
+// A string is only left unquoted if it's read back as one of these types,
+// so e.g. "1_000" stays a string even if a registered reader accepts it,
+// since the built-in integer literal takes precedence.
+func stringLiteral(s string) string {
+	v, n := readLiteral(s)
+	if n == 0 || n != len(s) {
+		return strconv.Quote(s)
+	}
+
+	// types which the foreign formats have themselves
+	switch v.(type) {
+	case bool, Null, int64, float64, string, Secret:
+		return strconv.Quote(s)
+	}
+
+	return s
+}
+
+// Returns a list of the keys' distinct parent groups, sorted. Top-level keys
+// have the group "".
+func parentGroups(keys []string) []string {
+	seen := make(map[string]bool)
+	groups := make([]string, 0)
+
+	for _, key := range keys {
+		group, _ := splitLast(key)
+
+		if !seen[group] {
+			seen[group] = true
+			groups = append(groups, group)
+		}
+	}
+
+	sort.Strings(groups)
+
+	return groups
+}
+
+// Returns the keys belonging directly to a group, as returned by
+// parentGroups, with the group's prefix removed.
+func groupKeys(keys []string, group string) []string {
+	names := make([]string, 0)
+
+	for _, key := range keys {
+		name := key
+		if group != "" {
+			if !strings.HasPrefix(key, group+".") {
+				continue
+			}
+			name = key[len(group)+1:]
+		}
+
+		if len(SplitKey(name)) == 1 {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
@@ -9,6 +9,9 @@
 //     foo # or after key groups
 //       bar = 123 # or after value keys
 //
+// The comments on the lines directly above a key, and the one at the end of
+// its line, document the key, and are available through Config.Doc.
+//
 //
 // Indentation
 //
@@ -29,6 +32,17 @@
 //
 // Finally, the first key in any configuration file must not be indented.
 //
+// Small groups may also be written on a single line, as an inline map of
+// comma separated assignments. Inline maps may be nested, and are expanded
+// into dotted keys, so the following lines define the same keys as the
+// indented group above them.
+//
+//     limits
+//       read = 10
+//       write = 5
+//
+//     limits = {read = 10, write = 5}
+//
 //
 // Keys
 //
@@ -42,6 +56,19 @@
 //     simple = true
 //     ♫ = "we're cool with unicode"
 //
+// Any segment of a key may instead be written as a double-quoted string, in
+// which case it may contain whitespace, dots and any other characters. A
+// quoted segment is a single segment, regardless of the dots inside it.
+//
+//     backends."api.example.com".weight = 2
+//     labels
+//       "team name" = "core"
+//
+// Config methods return and accept keys in a canonical form, where only the
+// segments which couldn't be written bare are quoted, so a."b" and a.b are
+// the same key. JoinKey and SplitKey convert between keys and their
+// segments.
+//
 // A key may only be defined once. Additionally, a value key may not have any
 // child keys.
 //
@@ -49,6 +76,42 @@
 //     foo.bar.baz = 2 # this key will collide with "key.bar"
 //     foo.bars = 3    # this line will not
 //
+// ReadWith and LoadWith can relax the first rule with ReadOptions.Override,
+// letting a later assignment to a value key replace an earlier one.
+//
+// Repeated key groups are the exception: each key group ending in "[]" adds
+// a new element to a list, which Config.Sections returns in order. Elements
+// may also be written as inline maps. Internally, each element's keys are
+// prefixed with its index, e.g. "upstream[1].host".
+//
+//     upstream[]
+//       host = "10.0.0.1"
+//       port = 80
+//     upstream[] = {host = "10.0.0.2", port = 8080}
+//
+//
+// Conditional blocks
+//
+// Lines may be included or left out depending on variables supplied through
+// ReadOptions.Vars. An "@if" directive is followed by an indented body, and
+// optionally by "@elif" and "@else" directives with bodies of their own. Only
+// the first body whose condition holds is read, as if it weren't indented, so
+// the usual rules about defining keys only apply to the selected bodies.
+//
+//     db
+//       @if env == "prod"
+//         host = "db.internal"
+//       @elif env != "dev"
+//         host = "db.staging"
+//       @else
+//         host = "localhost"
+//     @if debug
+//       log.level = "debug"
+//
+// A condition either compares a variable with a string, using "==" or "!=",
+// or names a variable on its own, in which case it holds if the variable is
+// defined. Comparing an undefined variable is an error.
+//
 //
 // Types
 //
@@ -57,13 +120,32 @@
 //     enabled = true
 //     active = false
 //
-// All numbers must be written in base-10. Integers and floats are distinguished
-// by the decimal point, which is required for floats, as is at least one digit
-// on either side of it.
+// The "null" literal marks a key as intentionally unset. Get reports such
+// keys with a Null value, and Merge uses them to remove keys defined by the
+// Configs beneath them.
+//
+//     proxy = null
+//
+// Integers and floats are distinguished by the decimal point or exponent,
+// one of which is required for floats. A decimal point needs at least one
+// digit on either side of it. The special values "inf", "-inf" and "nan" are
+// floats too.
 //
 //     neg = -47
 //     zero = 0.0
 //     pi = 3.1415
+//     epsilon = 1e-6
+//     avogadro = 6.02e23
+//     limit = inf
+//
+// Integers may also be written in hexadecimal, octal or binary, using the
+// "0x", "0o" and "0b" prefixes, and their digits may be separated by single
+// underscores. Since "0755" could be read either way, decimal integers may
+// not have leading zeros.
+//
+//     mode = 0o644
+//     mask = 0xff00
+//     limit = 1_000_000
 //
 // Any valid double-quoted Go string literals is also a valid walnut string.
 //
@@ -72,16 +154,67 @@
 //     EOL = "\r\n"
 //
 // Durations consist of 1..N (value, unit) pairs, where value is a positive
-// base-10 integer and unit is one of "ns", "us" (or "µs"), "ms", "s", "m",
+// base-10 number and unit is one of "ns", "us" (or "µs"), "ms", "s", "m",
 // "h", "d" or "w". These pairs must be ordered by the magnitude of their
 // units, in descending order, and each unit may only appear once. Pairs may
-// be separated by whitespace.
+// be separated by whitespace. Values may have a fraction, and the whole
+// duration may be preceded by a sign.
 //
 //     delay = 2m 30s
 //     interval = 750ms
+//     timeout = 1.5s
+//     skew = -2h 30m
+//
+// Periods are written like durations, but with "y", "mo", "w" and "d" as
+// their units, and whole numbers as their values. Since months and years
+// vary in length, periods are a separate type from durations and must have
+// a year or month component; ISO 8601 periods like "P1Y6M" and "P10D" are
+// accepted as well.
+//
+//     retention = 1y 6mo
+//     grace = 1mo 15d
 //
 // Times are represented in a "2006-01-02 15:04:05 -0700" format. The fraction
-// after the second is optional.
+// after the second is optional, and the offset may be replaced by an IANA
+// zone name. RFC 3339 timestamps are accepted too.
 //
 //     timestamp = 2013-02-25 17:07:46.409 +0100
+//     meeting = 2013-02-25 09:30:00 Europe/Berlin
+//     release = 2013-02-25T16:07:46Z
+//
+// Dates and times of day on their own are distinct types, Date and TimeOfDay,
+// since they don't refer to an instant. A time of day's seconds are optional.
+//
+//     maintenance = 2013-03-01
+//     window = 22:30
+//
+// Byte sizes are a number followed by an optional unit and a "B". Decimal
+// units ("K", "M", "G", "T", "P", "E") are powers of 1000, binary ones
+// ("Ki", "Mi", ...) powers of 1024. The number may have a fraction, as long
+// as the size works out to a whole number of bytes.
+//
+//     buffer = 64KiB
+//     limit = 1.5GB
+//
+// IP addresses, network prefixes and address:port pairs are written as
+// accepted by the net/netip package, with IPv6 addresses enclosed in brackets
+// when followed by a port. They are read as netip.Addr, netip.Prefix and
+// netip.AddrPort values respectively.
+//
+//     gateway = 10.0.0.1
+//     subnet = 10.0.0.0/8
+//     listen = [::1]:8080
+//
+// URLs consist of a scheme followed by "://" and extend up to the next
+// whitespace, so any spaces within them must be percent-encoded.
+//
+//     endpoint = https://example.com/api?v=2
+//
+// Secrets are kept out of configuration files by referring to them by name.
+// References are resolved by the SecretProvider in ReadOptions.Secrets when
+// the file is read, e.g. one returned by FileSecrets. The resulting Secret
+// values print as their references, and only reveal their contents through
+// Secret.Reveal.
+//
+//     password = secret("db/password")
 package walnut
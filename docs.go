@@ -0,0 +1,69 @@
+package walnut
+
+import (
+	"strings"
+)
+
+// Collects the block of comment lines directly above each line of the
+// input, keyed by line number. Blank lines end a block.
+func leadingComments(in []byte) map[int]string {
+	out := make(map[int]string)
+	block := make([]string, 0)
+
+	for index, content := range strings.Split(string(in), "\n") {
+		switch {
+		case !isEmpty(content):
+			if len(block) > 0 {
+				out[index+1] = strings.Join(block, "\n")
+			}
+			block = block[:0]
+		case strings.ContainsRune(content, '#'):
+			block = append(block, commentText(content))
+		default:
+			block = block[:0]
+		}
+	}
+
+	return out
+}
+
+// Returns the text of the comment in the input, without the '#' and the
+// space following it, or an empty string if there is no comment. The input
+// must start after any literals.
+func commentText(in string) string {
+	i := strings.IndexByte(in, '#')
+	if i < 0 {
+		return ""
+	}
+
+	text := strings.TrimRight(in[i+1:], Space)
+	return strings.TrimPrefix(text, " ")
+}
+
+// Records the documentation of a key: its leading comments, followed by the
+// comment in rest, the remainder of its line.
+func addDoc(docs map[string]string, key, leading, rest string) {
+	parts := make([]string, 0, 2)
+	for _, part := range []string{leading, commentText(rest)} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+
+	if len(parts) > 0 {
+		docs[key] = strings.Join(parts, "\n")
+	}
+}
+
+// Copies the documentation of a key, and of the groups containing it, from
+// a Config.
+func copyDocs(docs map[string]string, conf Config, key string) {
+	segments := SplitKey(key)
+
+	for i := 1; i <= len(segments); i++ {
+		k := JoinKey(segments[:i]...)
+		if doc := conf.Doc(k); doc != "" {
+			docs[k] = doc
+		}
+	}
+}
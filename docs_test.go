@@ -0,0 +1,106 @@
+package walnut
+
+import (
+	"testing"
+)
+
+func TestLeadingComments(t *testing.T) {
+	src := "# file header\n\n# first\n#\n#   indented\na = 1\n  # not attached\n\nb = 2 # trailing\nc = 3"
+
+	want := map[int]string{
+		6: "first\n\n  indented",
+	}
+
+	if got := leadingComments([]byte(src)); !eq(got, want) {
+		t.Errorf("leadingComments(%q):", src)
+		t.Errorf("   got %v", got)
+		t.Errorf("  want %v", want)
+	}
+}
+
+var commentTextTests = []struct {
+	in   string
+	want string
+}{
+	{"", ""},
+	{"   ", ""},
+	{" # comment ", "comment"},
+	{"#comment", "comment"},
+	{"#  two spaces", " two spaces"},
+	{"# a # b", "a # b"},
+}
+
+func TestCommentText(t *testing.T) {
+	for _, test := range commentTextTests {
+		if got := commentText(test.in); got != test.want {
+			t.Errorf("commentText(%q):", test.in)
+			t.Errorf("   got %q", got)
+			t.Errorf("  want %q", test.want)
+		}
+	}
+}
+
+const docSource = `# application configuration
+
+# HTTP server settings
+http # served on all interfaces
+  # address to listen on
+  # (host name or IP)
+  host = "localhost"
+  port = 8080 # TCP port
+
+  timeout = 30s
+# rate limits
+limits = {read = 10, write = 5} # per second
+name = "# not a comment" # but this is
+`
+
+var docTests = []struct {
+	key  string
+	want string
+}{
+	{"http", "HTTP server settings\nserved on all interfaces"},
+	{"http.host", "address to listen on\n(host name or IP)"},
+	{"http.port", "TCP port"},
+	{"http.timeout", ""},
+	{"limits", "rate limits\nper second"},
+	{"limits.read", ""},
+	{"name", "but this is"},
+	{"undefined", ""},
+}
+
+func TestConfigDoc(t *testing.T) {
+	conf, err := Read([]byte(docSource))
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+
+	for _, test := range docTests {
+		if got := conf.Doc(test.key); got != test.want {
+			t.Errorf("Config.Doc(%q):", test.key)
+			t.Errorf("   got %q", got)
+			t.Errorf("  want %q", test.want)
+		}
+	}
+
+	if got := conf.Select("http").Doc("port"); got != "TCP port" {
+		t.Errorf("Select(%q).Doc(%q): got %q, want %q", "http", "port", got, "TCP port")
+	}
+}
+
+func TestMergeDoc(t *testing.T) {
+	base, _ := Read([]byte("# server\nhttp\n  port = 80 # port\n  host = \"a\" # host"))
+	local, _ := Read([]byte("http.port = 8080 # local port"))
+
+	merged := Merge(base, local)
+
+	for key, want := range map[string]string{
+		"http":      "server",
+		"http.port": "local port",
+		"http.host": "host",
+	} {
+		if got := merged.Doc(key); got != want {
+			t.Errorf("Merge(...).Doc(%q): got %q, want %q", key, got, want)
+		}
+	}
+}
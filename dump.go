@@ -0,0 +1,54 @@
+package walnut
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+)
+
+const (
+	errDumpValue = "%q cannot be written as a walnut literal (is %s)"
+
+	// Written in place of redacted values.
+	Redacted = "<redacted>"
+)
+
+// Options controlling how a Config is dumped.
+type DumpOptions struct {
+	// Redact selects keys whose values are replaced by Redacted, e.g.
+	// regexp.MustCompile(`(password|token)$`). Secrets are always redacted.
+	Redact Matcher
+}
+
+// Writes a Config's keys and their values in walnut syntax, e.g. to log the
+// effective configuration at startup. Keys are sorted and grouped as by the
+// converters. Values of keys matching opts.Redact, and of all secrets, are
+// written as Redacted instead, so the output isn't necessarily valid walnut
+// source. Returns an error if a value can't be written as a literal.
+func Dump(w io.Writer, conf Config, opts *DumpOptions) error {
+	if opts == nil {
+		opts = &DumpOptions{}
+	}
+
+	keys := conf.Keys()
+	literals := make([]string, len(keys))
+
+	for i, key := range keys {
+		v, _ := conf.Get(key)
+
+		if _, ok := v.(Secret); ok || opts.Redact != nil && opts.Redact.MatchString(key) {
+			literals[i] = Redacted
+			continue
+		}
+
+		literal, ok := formatLiteral(v)
+		if !ok {
+			typ := reflect.TypeOf(v).String()
+			return fmt.Errorf(errDumpValue, key, typ)
+		}
+		literals[i] = literal
+	}
+
+	_, err := w.Write(writeTree(keys, literals))
+	return err
+}
@@ -0,0 +1,82 @@
+package walnut
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"net/netip"
+	"regexp"
+	"testing"
+)
+
+const dumpSource = `
+db
+  host = "localhost"
+  port = 5432
+  password = secret("db/password")
+api.token = "t0ken"
+api.timeout = 30s
+`
+
+var dumpTests = []struct {
+	opts *DumpOptions
+	want string
+}{
+	{
+		nil,
+		"api\n  timeout = 30s\n  token = \"t0ken\"\ndb\n  host = \"localhost\"\n  password = <redacted>\n  port = 5432\n",
+	},
+	{
+		&DumpOptions{Redact: regexp.MustCompile(`token$`)},
+		"api\n  timeout = 30s\n  token = <redacted>\ndb\n  host = \"localhost\"\n  password = <redacted>\n  port = 5432\n",
+	},
+}
+
+func TestDump(t *testing.T) {
+	conf, _, err := ReadWith([]byte(dumpSource), &ReadOptions{Secrets: mapSecrets{"db/password": "hunter2"}})
+	if err != nil {
+		t.Fatalf("ReadWith: %v", err)
+	}
+
+	for _, test := range dumpTests {
+		var buf bytes.Buffer
+		if err := Dump(&buf, conf, test.opts); err != nil {
+			t.Errorf("Dump(%+v): %v", test.opts, err)
+			continue
+		}
+
+		if got := buf.String(); got != test.want {
+			t.Errorf("Dump(%+v):", test.opts)
+			t.Errorf("   got %q", got)
+			t.Errorf("  want %q", test.want)
+		}
+	}
+}
+
+func TestDumpSelect(t *testing.T) {
+	conf, err := Read([]byte("a.b = 1\na.c.d = nan\nx = 2"))
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := Dump(&buf, conf.Select("a"), nil); err != nil {
+		t.Fatalf("Dump: %v", err)
+	}
+
+	if want := "b = 1\nc\n  d = nan\n"; buf.String() != want {
+		t.Errorf("Dump(Select(%q)): got %q, want %q", "a", buf.String(), want)
+	}
+}
+
+func TestDumpError(t *testing.T) {
+	conf := &config{data: map[string]interface{}{
+		"ok":   math.Inf(1),
+		"addr": netip.Addr{},
+	}}
+
+	want := fmt.Errorf(errDumpValue, "addr", "netip.Addr")
+	if err := Dump(&bytes.Buffer{}, conf, nil); !eq(err, want) {
+		t.Errorf("Dump: got %v, want %v", err, want)
+	}
+}
@@ -0,0 +1,181 @@
+package walnut
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+const (
+	errEnvName      = "%q is not a valid environment variable name (from %q)"
+	errEnvCollision = "%q and %q both map to %s"
+	errEnvValue     = "%q cannot be represented as an environment variable (is %s)"
+	errEnvSecret    = "%q is a secret, which is only written with RevealSecrets set"
+)
+
+var (
+	reEnvName    = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	reShellPlain = regexp.MustCompile(`^[A-Za-z0-9_@%+=:,./\-]+$`)
+)
+
+// Options controlling how a Config is flattened into environment variables.
+type EnvOptions struct {
+	// Prefix is prepended to every variable name, e.g. "APP_".
+	Prefix string
+
+	// Mangle maps a key to a variable name. Defaults to EnvName.
+	Mangle func(key string) string
+
+	// Dotenv makes WriteEnv produce a .env file rather than a shell
+	// script.
+	Dotenv bool
+
+	// RevealSecrets writes the values of secrets, as returned by
+	// Secret.Reveal. Without it, a Config holding any secrets is
+	// rejected, since the variables usually end up in a child process's
+	// environment or in a file.
+	RevealSecrets bool
+}
+
+// Converts a key to an environment variable name by upper-casing it and
+// replacing every character other than letters, digits and underscores
+// with an underscore; "http.port" becomes "HTTP_PORT".
+func EnvName(key string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case 'a' <= r && r <= 'z':
+			return r - 'a' + 'A'
+		case 'A' <= r && r <= 'Z', '0' <= r && r <= '9', r == '_':
+			return r
+		}
+		return '_'
+	}, key)
+}
+
+// Flattens a Config into a list of "NAME=value" pairs, sorted by key, in
+// the format used by os.Environ and exec.Cmd. Strings are included as they
+// are, secrets as their revealed values, and other values as their walnut
+// literals. Null keys are left out.
+//
+// Returns an error if a key maps to an invalid variable name, if two keys
+// map to the same name, or if a key holds a secret and opts.RevealSecrets
+// isn't set.
+func Environ(conf Config, opts *EnvOptions) ([]string, error) {
+	vars, err := environ(conf, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]string, len(vars))
+	for i, v := range vars {
+		out[i] = v.name + "=" + v.value
+	}
+
+	return out, nil
+}
+
+// Writes a Config's keys as environment variables, one per line. By
+// default the output is a shell script exporting each variable, suitable
+// for sourcing; with opts.Dotenv set it's a .env file instead. Values are
+// quoted where necessary, and secrets are handled as by Environ.
+func WriteEnv(w io.Writer, conf Config, opts *EnvOptions) error {
+	vars, err := environ(conf, opts)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+
+	for _, v := range vars {
+		if opts != nil && opts.Dotenv {
+			fmt.Fprintf(&buf, "%s=%s\n", v.name, dotenvQuote(v.value))
+		} else {
+			fmt.Fprintf(&buf, "export %s=%s\n", v.name, shellQuote(v.value))
+		}
+	}
+
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+type envVar struct {
+	name  string
+	value string
+}
+
+func environ(conf Config, opts *EnvOptions) ([]envVar, error) {
+	if opts == nil {
+		opts = &EnvOptions{}
+	}
+
+	mangle := opts.Mangle
+	if mangle == nil {
+		mangle = EnvName
+	}
+
+	vars := make([]envVar, 0)
+	owners := make(map[string]string)
+
+	for _, key := range conf.Keys() {
+		v, _ := conf.Get(key)
+		if _, ok := v.(Null); ok {
+			continue
+		}
+
+		name := opts.Prefix + mangle(key)
+
+		if !reEnvName.MatchString(name) {
+			return nil, fmt.Errorf(errEnvName, name, key)
+		}
+		if owner, ok := owners[name]; ok {
+			return nil, fmt.Errorf(errEnvCollision, owner, key, name)
+		}
+		owners[name] = key
+
+		if s, ok := v.(Secret); ok {
+			if !opts.RevealSecrets {
+				return nil, fmt.Errorf(errEnvSecret, key)
+			}
+			v = s.Reveal()
+		}
+
+		value, ok := v.(string)
+		if !ok {
+			if value, ok = formatLiteral(v); !ok {
+				typ := reflect.TypeOf(v).String()
+				return nil, fmt.Errorf(errEnvValue, key, typ)
+			}
+		}
+
+		vars = append(vars, envVar{name, value})
+	}
+
+	return vars, nil
+}
+
+// Quotes a string for POSIX shells, using single quotes unless the string
+// is made up of only safe characters.
+func shellQuote(s string) string {
+	if reShellPlain.MatchString(s) {
+		return s
+	}
+
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// Quotes a string for .env files. Single quotes are preferred since their
+// contents aren't interpreted, but can't hold quotes or line breaks.
+func dotenvQuote(s string) string {
+	switch {
+	case reShellPlain.MatchString(s):
+		return s
+	case !strings.ContainsAny(s, "'\r\n"):
+		return "'" + s + "'"
+	}
+
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "$", `\$`)
+	return `"` + r.Replace(s) + `"`
+}
@@ -0,0 +1,149 @@
+package walnut
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+var envNameTests = []struct {
+	in   string
+	want string
+}{
+	{"port", "PORT"},
+	{"http.port", "HTTP_PORT"},
+	{"cookie-jar.max_age", "COOKIE_JAR_MAX_AGE"},
+	{"♫", "_"},
+}
+
+func TestEnvName(t *testing.T) {
+	for _, test := range envNameTests {
+		if got := EnvName(test.in); got != test.want {
+			t.Errorf("EnvName(%q):", test.in)
+			t.Errorf("   got %q", got)
+			t.Errorf("  want %q", test.want)
+		}
+	}
+}
+
+var envSample = &config{
+	data: map[string]interface{}{
+		"http.host":  "localhost",
+		"http.port":  int64(8080),
+		"debug":      false,
+		"ratio":      float64(0.5),
+		"cookie.ttl": 48*time.Hour + 30*time.Minute,
+		"motd":       "it's a\nnew day",
+		"greeting":   "hello world",
+		"proxy":      Null{},
+	},
+}
+
+var environTests = []struct {
+	conf *config
+	opts *EnvOptions
+	want []string
+	err  error
+}{
+	{
+		envSample,
+		nil,
+		[]string{
+			"COOKIE_TTL=2d 30m",
+			"DEBUG=false",
+			"GREETING=hello world",
+			"HTTP_HOST=localhost",
+			"HTTP_PORT=8080",
+			"MOTD=it's a\nnew day",
+			"RATIO=0.5",
+		},
+		nil,
+	},
+	{
+		&config{data: map[string]interface{}{"http.port": int64(80)}},
+		&EnvOptions{Prefix: "APP_", Mangle: strings.ToLower},
+		nil,
+		fmt.Errorf(errEnvName, "APP_http.port", "http.port"),
+	},
+	{
+		&config{data: map[string]interface{}{"http.port": int64(80)}},
+		&EnvOptions{Prefix: "APP_"},
+		[]string{"APP_HTTP_PORT=80"},
+		nil,
+	},
+	{
+		&config{data: map[string]interface{}{"1st": int64(1)}},
+		nil,
+		nil,
+		fmt.Errorf(errEnvName, "1ST", "1st"),
+	},
+	{
+		&config{data: map[string]interface{}{"a.b": int64(1), "a-b": int64(2)}},
+		nil,
+		nil,
+		fmt.Errorf(errEnvCollision, "a-b", "a.b", "A_B"),
+	},
+	{
+		&config{data: map[string]interface{}{"db.password": Secret{"db", "hunter2"}}},
+		nil,
+		nil,
+		fmt.Errorf(errEnvSecret, "db.password"),
+	},
+	{
+		&config{data: map[string]interface{}{"db.password": Secret{"db", "it's 5s"}}},
+		&EnvOptions{RevealSecrets: true},
+		[]string{"DB_PASSWORD=it's 5s"},
+		nil,
+	},
+}
+
+func TestEnviron(t *testing.T) {
+	for _, test := range environTests {
+		got, err := Environ(test.conf, test.opts)
+		if !eq(got, test.want) || !eq(err, test.err) {
+			t.Errorf("Environ(%v, %+v):", test.conf.data, test.opts)
+			t.Errorf("   got %q, %v", got, err)
+			t.Errorf("  want %q, %v", test.want, test.err)
+		}
+	}
+}
+
+var writeEnvTests = []struct {
+	opts *EnvOptions
+	want string
+}{
+	{
+		nil,
+		"export COOKIE_TTL='2d 30m'\n" +
+			"export DEBUG=false\n" +
+			"export GREETING='hello world'\n" +
+			"export HTTP_HOST=localhost\n" +
+			"export HTTP_PORT=8080\n" +
+			"export MOTD='it'\\''s a\nnew day'\n" +
+			"export RATIO=0.5\n",
+	},
+	{
+		&EnvOptions{Dotenv: true},
+		"COOKIE_TTL='2d 30m'\n" +
+			"DEBUG=false\n" +
+			"GREETING='hello world'\n" +
+			"HTTP_HOST=localhost\n" +
+			"HTTP_PORT=8080\n" +
+			"MOTD=\"it's a\\nnew day\"\n" +
+			"RATIO=0.5\n",
+	},
+}
+
+func TestWriteEnv(t *testing.T) {
+	for _, test := range writeEnvTests {
+		var buf bytes.Buffer
+		err := WriteEnv(&buf, envSample, test.opts)
+		if buf.String() != test.want || err != nil {
+			t.Errorf("WriteEnv(%+v):", test.opts)
+			t.Errorf("   got %q, %v", buf.String(), err)
+			t.Errorf("  want %q, %v", test.want, nil)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package walnut
+
+import (
+	"flag"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+const errFlagValue = "not a valid %s"
+
+// Registers a flag with fs for each of the Config's value keys, named after
+// the key, e.g. -http.port. A flag's default is its key's value, and its
+// usage text is the comment documenting the key in the configuration file.
+//
+// Returns a Config combining both: once fs has been parsed, the keys whose
+// flags were set have the flags' values, and all others keep the values they
+// had in conf. A flag's argument is read as a literal of its key's type,
+// except for strings, which are taken as they are, without quotes; boolean
+// flags may be given without an argument.
+//
+// Keys set to null or to a secret get no flag, and neither do keys which
+// aren't valid flag names, or whose names are already taken in fs.
+func BindFlags(fs *flag.FlagSet, conf Config) Config {
+	bound := &config{
+		data:      make(map[string]interface{}),
+		positions: make(map[string]Position),
+		docs:      make(map[string]string),
+		sections:  make(sectionCounter),
+	}
+
+	if c, ok := conf.(*config); ok {
+		for group, n := range c.sections {
+			if strings.HasPrefix(group, c.prefix) {
+				bound.sections[group[len(c.prefix):]] = n
+			}
+		}
+	}
+
+	for _, key := range conf.Keys() {
+		v, _ := conf.Get(key)
+		bound.data[key] = v
+
+		if p, ok := conf.Position(key); ok {
+			bound.positions[key] = p
+		}
+		copyDocs(bound.docs, conf, key)
+
+		switch v.(type) {
+		case Null, Secret:
+			continue
+		}
+
+		if key == "" || key[0] == '-' || strings.ContainsRune(key, '=') || fs.Lookup(key) != nil {
+			continue
+		}
+
+		fs.Var(&flagValue{bound, key}, key, bound.docs[key])
+	}
+
+	return bound
+}
+
+// A flag.Value setting a single key of a Config.
+type flagValue struct {
+	conf *config
+	key  string
+}
+
+func (f *flagValue) String() string {
+	// the flag package calls this on a zero flagValue, too
+	if f.conf == nil {
+		return ""
+	}
+
+	v := f.conf.data[f.key]
+	if s, ok := v.(string); ok {
+		return s
+	}
+
+	literal, _ := formatLiteral(v)
+	return literal
+}
+
+func (f *flagValue) Set(s string) error {
+	current := f.conf.data[f.key]
+
+	v, ok := interface{}(s), true
+	if _, isString := current.(string); !isString {
+		v, ok = parseLiteral(s)
+	}
+
+	// integers are fine where floats are expected, as long as they're
+	// exactly representable
+	if _, isInt := v.(int64); isInt && reflect.TypeOf(current) == float64Type {
+		var exact bool
+		if v, _, exact = coerce(v, float64Type); !exact {
+			return fmt.Errorf(errLossy, s, float64Type, int64Type)
+		}
+	}
+
+	if !ok || reflect.TypeOf(v) != reflect.TypeOf(current) {
+		return fmt.Errorf(errFlagValue, reflect.TypeOf(current))
+	}
+
+	// the value no longer comes from the configuration file
+	f.conf.data[f.key] = v
+	delete(f.conf.positions, f.key)
+
+	return nil
+}
+
+// Lets boolean flags be given without an argument.
+func (f *flagValue) IsBoolFlag() bool {
+	if f.conf == nil {
+		return false
+	}
+
+	_, ok := f.conf.data[f.key].(bool)
+	return ok
+}
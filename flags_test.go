@@ -0,0 +1,139 @@
+package walnut
+
+import (
+	"bytes"
+	"flag"
+	"strings"
+	"testing"
+	"time"
+)
+
+const flagsSource = `
+http
+  # address to listen on
+  host = "localhost"
+  port = 8080 # TCP port
+  timeout = 30s
+  ratio = 0.5
+debug = false
+proxy = null
+password = secret("pw")
+`
+
+func TestBindFlags(t *testing.T) {
+	conf, _, err := ReadWith([]byte(flagsSource), &ReadOptions{Secrets: mapSecrets{"pw": "x"}})
+	if err != nil {
+		t.Fatalf("ReadWith: %v", err)
+	}
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(&bytes.Buffer{})
+	bound := BindFlags(fs, conf)
+
+	args := []string{"-http.port", "9090", "-http.host=example.com", "-debug", "-http.ratio", "2"}
+	if err := fs.Parse(args); err != nil {
+		t.Fatalf("Parse(%q): %v", args, err)
+	}
+
+	if got := bound.Int64("http.port"); got != 9090 {
+		t.Errorf("http.port: got %d, want 9090", got)
+	}
+	if got, _ := bound.Get("http.host"); got != "example.com" {
+		t.Errorf("http.host: got %v, want %v", got, "example.com")
+	}
+	if got := bound.Bool("debug"); !got {
+		t.Errorf("debug: got %v, want true", got)
+	}
+	if got := bound.Float64("http.ratio"); got != 2 {
+		t.Errorf("http.ratio: got %v, want 2", got)
+	}
+	if got := bound.Duration("http.timeout"); got != 30*time.Second {
+		t.Errorf("http.timeout: got %v, want 30s", got)
+	}
+
+	// flags take precedence over the file, which is left alone
+	if got := conf.Int64("http.port"); got != 8080 {
+		t.Errorf("original http.port: got %d, want 8080", got)
+	}
+	if _, ok := bound.Position("http.port"); ok {
+		t.Errorf("http.port set by a flag still has a position")
+	}
+	if _, ok := bound.Position("http.timeout"); !ok {
+		t.Errorf("http.timeout has no position")
+	}
+
+	for _, name := range []string{"proxy", "password"} {
+		if fs.Lookup(name) != nil {
+			t.Errorf("flag -%s should not be registered", name)
+		}
+	}
+
+	if got := fs.Lookup("http.host").Usage; got != "address to listen on" {
+		t.Errorf("usage of -http.host: got %q", got)
+	}
+	if got := fs.Lookup("http.port").DefValue; got != "8080" {
+		t.Errorf("default of -http.port: got %q, want %q", got, "8080")
+	}
+	if got := fs.Lookup("http.port").Usage; got != "TCP port" {
+		t.Errorf("usage of -http.port: got %q", got)
+	}
+}
+
+func TestBindFlagsErrors(t *testing.T) {
+	conf, err := Read([]byte("port = 8080\ntimeout = 30s"))
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+
+	for _, args := range [][]string{
+		{"-port", "http"},
+		{"-port", "1.5"},
+		{"-timeout", "30"},
+	} {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		fs.SetOutput(&bytes.Buffer{})
+		BindFlags(fs, conf)
+
+		if err := fs.Parse(args); err == nil || !strings.Contains(err.Error(), "not a valid") {
+			t.Errorf("Parse(%q): got %v, want an invalid value error", args, err)
+		}
+	}
+}
+
+// Integers which floats can't hold exactly mustn't silently change.
+func TestBindFlagsLossy(t *testing.T) {
+	conf, err := Read([]byte("ratio = 0.5"))
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(&bytes.Buffer{})
+	bound := BindFlags(fs, conf)
+
+	args := []string{"-ratio", "9007199254740993"}
+	if err := fs.Parse(args); err == nil || !strings.Contains(err.Error(), "without loss") {
+		t.Errorf("Parse(%q): got %v, want a lossy conversion error", args, err)
+	}
+	if got := bound.Float64("ratio"); got != 0.5 {
+		t.Errorf("ratio: got %v, want 0.5", got)
+	}
+}
+
+func TestBindFlagsExisting(t *testing.T) {
+	conf, err := Read([]byte("config = \"a.wn\"\nport = 1"))
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	path := fs.String("config", "", "configuration file")
+	BindFlags(fs, conf)
+
+	if err := fs.Parse([]string{"-config", "b.wn", "-port", "2"}); err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if *path != "b.wn" {
+		t.Errorf("-config: got %q, want %q", *path, "b.wn")
+	}
+}
@@ -0,0 +1,288 @@
+package walnut
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Formats a value as a walnut literal. The second return value is false if
+// the value's type (or the value itself) has no walnut representation.
+func formatLiteral(v interface{}) (string, bool) {
+	switch v := v.(type) {
+	case Null:
+		return "null", true
+	case bool:
+		return strconv.FormatBool(v), true
+	case int64:
+		return strconv.FormatInt(v, 10), true
+	case float64:
+		return formatFloat64(v), true
+	case string:
+		return strconv.Quote(v), true
+	case time.Time:
+		return formatTime(v)
+	case Date:
+		return v.String(), true
+	case TimeOfDay:
+		return v.String(), true
+	case time.Duration:
+		return formatDuration(v), true
+	case Period:
+		return formatPeriod(v)
+	case ByteSize:
+		return formatBytes(v)
+	case netip.Addr:
+		return v.String(), v.IsValid()
+	case netip.Prefix:
+		return v.String(), v.IsValid()
+	case netip.AddrPort:
+		return v.String(), v.IsValid()
+	case *url.URL:
+		return formatURL(v)
+	case Secret:
+		return v.String(), v.name != ""
+	}
+
+	return formatCustom(v)
+}
+
+// Formats a floating point value, making sure the result can't be mistaken
+// for an integer: it either has a decimal point (with a digit on either side
+// of it) or, for very large and very small values, an exponent.
+func formatFloat64(f float64) string {
+	switch {
+	case math.IsNaN(f):
+		return "nan"
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	}
+
+	if abs := math.Abs(f); abs != 0 && (abs < 1e-6 || abs >= 1e21) {
+		return strconv.FormatFloat(f, 'e', -1, 64)
+	}
+
+	s := strconv.FormatFloat(f, 'f', -1, 64)
+	if !strings.Contains(s, ".") {
+		s += ".0"
+	}
+
+	return s
+}
+
+// Formats a timestamp in the "2006-01-02 15:04:05 -0700" format, including
+// any fraction of a second. Times in a named zone are written with the
+// zone's name instead of its offset.
+func formatTime(t time.Time) (string, bool) {
+	if y := t.Year(); y < 0 || y > 9999 {
+		return "", false
+	}
+
+	if name := zoneName(t); name != "" {
+		return t.Format("2006-01-02 15:04:05.999999999 ") + name, true
+	}
+
+	return t.Format("2006-01-02 15:04:05.999999999 -0700"), true
+}
+
+// Returns the IANA name of the timestamp's zone, or "" if it doesn't have
+// one which readTime would map back to the same offset. Fixed offsets, UTC
+// and the local zone have no usable name.
+func zoneName(t time.Time) string {
+	name := t.Location().String()
+	if name == "" || name == "UTC" || name == "Local" {
+		return ""
+	}
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return ""
+	}
+
+	_, want := t.Zone()
+	if _, got := t.In(loc).Zone(); got != want {
+		return ""
+	}
+
+	return name
+}
+
+// Formats a duration as a space separated list of (value, unit) pairs,
+// largest unit first, preceded by a minus sign if it's negative.
+func formatDuration(d time.Duration) string {
+	if d == 0 {
+		return "0s"
+	}
+
+	// the magnitude of the smallest duration doesn't fit in a
+	// time.Duration, but does fit in a uint64
+	sign, rest := "", uint64(d)
+	if d < 0 {
+		sign, rest = "-", -rest
+	}
+
+	parts := make([]string, 0)
+
+	for i := len(durations) - 1; i >= 0 && rest > 0; i-- {
+		unit := durations[i]
+
+		// skip the alternative spellings of "us"
+		if unit.value == time.Microsecond && unit.name != "us" {
+			continue
+		}
+
+		if n := rest / uint64(unit.value); n > 0 {
+			parts = append(parts, strconv.FormatUint(n, 10)+unit.name)
+			rest -= n * uint64(unit.value)
+		}
+	}
+
+	return sign + strings.Join(parts, " ")
+}
+
+// Formats a period as a list of (value, unit) pairs, or in ISO 8601 format
+// if it has neither years nor months, since it would otherwise be read back
+// as a duration. Periods whose components have different signs have no
+// walnut representation.
+func formatPeriod(p Period) (string, bool) {
+	switch {
+	case p.Years >= 0 && p.Months >= 0 && p.Days >= 0:
+	case p.Years <= 0 && p.Months <= 0 && p.Days <= 0:
+		s, _ := formatPeriod(Period{-p.Years, -p.Months, -p.Days})
+		return "-" + s, true
+	default:
+		return "", false
+	}
+
+	if p.Years == 0 && p.Months == 0 {
+		return "P" + strconv.Itoa(p.Days) + "D", true
+	}
+
+	parts := make([]string, 0, 3)
+	for _, part := range []struct {
+		n    int
+		unit string
+	}{{p.Years, "y"}, {p.Months, "mo"}, {p.Days, "d"}} {
+		if part.n != 0 {
+			parts = append(parts, strconv.Itoa(part.n)+part.unit)
+		}
+	}
+
+	return strings.Join(parts, " "), true
+}
+
+// Generates walnut source from a set of keys and their literals. Keys must
+// be sorted, and must not conflict with each other. Key segments shared
+// with the previous key are folded into indented key groups.
+func writeTree(keys, literals []string) []byte {
+	var buf bytes.Buffer
+	var prev []string
+
+	for i, key := range keys {
+		parts := SplitKey(key)
+		for j, part := range parts {
+			parts[j] = quoteKey(part)
+		}
+		last := len(parts) - 1
+
+		// find how many of the previous key's groups we're still inside
+		common := 0
+		for common < len(prev)-1 && common < last && prev[common] == parts[common] {
+			common++
+		}
+
+		for j := common; j < last; j++ {
+			buf.WriteString(strings.Repeat("  ", j))
+			buf.WriteString(parts[j])
+			buf.WriteByte('\n')
+		}
+
+		buf.WriteString(strings.Repeat("  ", last))
+		buf.WriteString(parts[last])
+		buf.WriteString(" = ")
+		buf.WriteString(literals[i])
+		buf.WriteByte('\n')
+
+		prev = parts
+	}
+
+	return buf.Bytes()
+}
+
+// Formats a byte size using the unit which yields the smallest whole
+// number, preferring binary units over decimal ones.
+func formatBytes(b ByteSize) (string, bool) {
+	if b < 0 {
+		return "", false
+	}
+
+	best := byteSizes[0]
+
+	for _, unit := range byteSizes {
+		if b == 0 || int64(b)%unit.value != 0 {
+			continue
+		}
+		if unit.value > best.value || unit.value == best.value && strings.HasSuffix(unit.name, "i") {
+			best = unit
+		}
+	}
+
+	return strconv.FormatInt(int64(b)/best.value, 10) + best.name + "B", true
+}
+
+// Returns the size's walnut literal, e.g. "64KiB".
+func (b ByteSize) String() string {
+	if s, ok := formatBytes(b); ok {
+		return s
+	}
+	return strconv.FormatInt(int64(b), 10) + "B"
+}
+
+// Returns the date's walnut literal, e.g. "2013-02-25".
+func (d Date) String() string {
+	return fmt.Sprintf("%04d-%02d-%02d", d.Year, d.Month, d.Day)
+}
+
+// Returns the time's walnut literal, e.g. "22:30:00", including any fraction
+// of a second.
+func (t TimeOfDay) String() string {
+	s := fmt.Sprintf("%02d:%02d:%02d", t.Hour, t.Minute, t.Second)
+	if t.Nanosecond != 0 {
+		s += strings.TrimRight(fmt.Sprintf(".%09d", t.Nanosecond), "0")
+	}
+
+	return s
+}
+
+// Returns the period's walnut literal, e.g. "1y 6mo".
+func (p Period) String() string {
+	if s, ok := formatPeriod(p); ok {
+		return s
+	}
+	return fmt.Sprintf("%dy %dmo %dd", p.Years, p.Months, p.Days)
+}
+
+// Formats an absolute URL. Returns false for URLs which wouldn't be read back
+// as one, i.e. those without a scheme and "//", or containing whitespace.
+func formatURL(u *url.URL) (string, bool) {
+	if u == nil {
+		return "", false
+	}
+
+	s := u.String()
+	if !reURL.MatchString(s) || strings.ContainsAny(s, Space) {
+		return "", false
+	}
+	if _, n := readURL(s); n != len(s) {
+		return "", false
+	}
+
+	return s, true
+}
@@ -0,0 +1,231 @@
+package walnut
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const (
+	errINISyntax = "INI syntax error on line %d: %s"
+)
+
+// Converts an INI file to walnut source. Sections become key groups, and may
+// be nested using dots ("[http.limits]"). Names which aren't valid bare keys,
+// e.g. "[my section]", become quoted key segments. Lines may be commented out
+// with either ';' or '#'.
+//
+// INI values are untyped; values which are valid walnut literals are kept as
+// they are, so "port = 8080" remains an integer. Everything else is treated
+// as a string, unless quoted in which case it's always a string. Since INI
+// files commonly allow keys to be repeated, later values replace earlier
+// ones, with a Warning for each replaced value.
+func FromINI(in []byte) ([]byte, []Warning, error) {
+	lines := strings.Split(string(in), "\n")
+	table := make(map[string]string)
+	warnings := make([]Warning, 0)
+	section := ""
+
+	for i, line := range lines {
+		index := i + 1
+		line = strings.TrimSpace(line)
+
+		if line == "" || line[0] == ';' || line[0] == '#' {
+			continue
+		}
+
+		if line[0] == '[' {
+			end := strings.IndexByte(line, ']')
+			if end < 0 || !isINIComment(line[end+1:]) {
+				return nil, nil, fmt.Errorf(errINISyntax, index, "expected ]")
+			}
+
+			name := strings.TrimSpace(line[1:end])
+			key, ok := fromINIKey(name)
+			if !ok {
+				return nil, nil, fmt.Errorf(errImportKey, name)
+			}
+			section = key
+			continue
+		}
+
+		sep := strings.IndexAny(line, "=:")
+		if sep < 0 {
+			return nil, nil, fmt.Errorf(errINISyntax, index, "expected key = value")
+		}
+
+		name := strings.TrimSpace(line[:sep])
+		key, ok := fromINIKey(name)
+		if !ok {
+			return nil, nil, fmt.Errorf(errImportKey, name)
+		}
+		if section != "" {
+			key = section + "." + key
+		}
+
+		literal, err := iniLiteral(strings.TrimSpace(line[sep+1:]))
+		if err != nil {
+			return nil, nil, fmt.Errorf(errINISyntax, index, err)
+		}
+
+		if _, ok := table[key]; ok {
+			warnings = append(warnings, Warning{key, "replaced by a later value"})
+		}
+
+		table[key] = literal
+	}
+
+	out, err := writeTable(table)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return out, warnings, nil
+}
+
+// Converts an INI value to a walnut literal.
+func iniLiteral(in string) (string, error) {
+	switch {
+	case in == "":
+		return `""`, nil
+	case in[0] == '"':
+		s, n := readString(in)
+		if n == 0 || !isINIComment(in[n:]) {
+			return "", fmt.Errorf("invalid quoted string")
+		}
+		return strconv.Quote(s), nil
+	case in[0] == '\'':
+		end := strings.IndexByte(in[1:], '\'')
+		if end < 0 || !isINIComment(in[end+2:]) {
+			return "", fmt.Errorf("invalid quoted string")
+		}
+		return strconv.Quote(in[1 : end+1]), nil
+	}
+
+	// strip trailing comments, which must be preceded by whitespace
+	for i := 1; i < len(in); i++ {
+		if (in[i] == ';' || in[i] == '#') && strings.ContainsRune(" \t", rune(in[i-1])) {
+			in = strings.TrimSpace(in[:i])
+			break
+		}
+	}
+
+	if _, ok := parseLiteral(in); ok {
+		return in, nil
+	}
+
+	return stringLiteral(in), nil
+}
+
+// Returns true if the input is empty or a comment.
+func isINIComment(in string) bool {
+	in = strings.TrimSpace(in)
+	return in == "" || in[0] == ';' || in[0] == '#'
+}
+
+// Encodes a Config as an INI file. Top-level keys are written first, then a
+// section for each key group.
+//
+// Values are written as walnut literals, which FromINI understands. Strings
+// are written without quotes when doing so doesn't change their meaning.
+// Keys which can't be expressed in INI, and values of types walnut literals
+// can't represent, are skipped and reported as Warnings.
+func ToINI(conf Config) ([]byte, []Warning, error) {
+	var buf bytes.Buffer
+	warnings := make([]Warning, 0)
+	keys := conf.Keys()
+
+	for _, group := range parentGroups(keys) {
+		if group != "" {
+			section, ok := toINIKey(group)
+			if !ok {
+				warnings = append(warnings, Warning{group, "section name cannot be represented in INI"})
+				continue
+			}
+			if buf.Len() > 0 {
+				buf.WriteByte('\n')
+			}
+			fmt.Fprintf(&buf, "[%s]\n", section)
+		}
+
+		for _, name := range groupKeys(keys, group) {
+			key := name
+			if group != "" {
+				key = group + "." + name
+			}
+
+			iniName, ok := toINIKey(name)
+			if !ok {
+				warnings = append(warnings, Warning{key, "key cannot be represented in INI"})
+				continue
+			}
+
+			v, _ := conf.Get(key)
+
+			literal, ok := formatINI(v)
+			if !ok {
+				typ := reflect.TypeOf(v).String()
+				warnings = append(warnings, Warning{key, typ + " cannot be represented in INI"})
+				continue
+			}
+
+			fmt.Fprintf(&buf, "%s = %s\n", iniName, literal)
+		}
+	}
+
+	return buf.Bytes(), warnings, nil
+}
+
+// Formats a value for an INI file.
+func formatINI(v interface{}) (string, bool) {
+	s, ok := v.(string)
+	if !ok {
+		return formatLiteral(v)
+	}
+
+	// quote strings which would otherwise be read back differently
+	literal, err := iniLiteral(s)
+	if err != nil || literal != strconv.Quote(s) || strings.TrimSpace(s) != s ||
+		strings.ContainsAny(s, ";#") {
+		return strconv.Quote(s), true
+	}
+
+	for _, r := range s {
+		if r < 0x20 || r == 0x7f {
+			return strconv.Quote(s), true
+		}
+	}
+
+	return s, true
+}
+
+// Converts a key or section name from an INI file to a walnut key. INI has
+// no quoting, so its names are split at every dot, and segments which
+// aren't valid bare keys are quoted. Returns false if a segment is empty.
+func fromINIKey(name string) (string, bool) {
+	segments := strings.Split(name, ".")
+	for _, s := range segments {
+		if s == "" {
+			return "", false
+		}
+	}
+
+	return JoinKey(segments...), true
+}
+
+// Converts a walnut key to its form in an INI file, the inverse of
+// fromINIKey. Returns false if the key can't be written to an INI file, e.g.
+// because a segment contains a dot.
+func toINIKey(key string) (string, bool) {
+	segments := SplitKey(key)
+	for _, s := range segments {
+		if s == "" || s != strings.TrimSpace(s) || s[0] == '#' ||
+			strings.ContainsAny(s, ".=:;[]\"'\r\n") {
+			return "", false
+		}
+	}
+
+	return strings.Join(segments, "."), true
+}
@@ -0,0 +1,138 @@
+package walnut
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+var fromINITests = []struct {
+	in       string
+	want     string
+	warnings []Warning
+	err      error
+}{
+	{"", "", nil, nil},
+	{"; comment\n# comment\n", "", nil, nil},
+	{"a = true\nb: 12\nc = 1.5", "a = true\nb = 12\nc = 1.5\n", nil, nil},
+	{"a = hello world", "a = \"hello world\"\n", nil, nil},
+	{"a = hello ; comment", "a = \"hello\"\n", nil, nil},
+	{"a = x;y", "a = \"x;y\"\n", nil, nil},
+	{"a =", "a = \"\"\n", nil, nil},
+	{"a = \"12\"\nb = 'C:\\dir'", "a = \"12\"\nb = \"C:\\\\dir\"\n", nil, nil},
+	{"a = 2m 30s\nb = 2013-02-25 17:07:46 +0100", "a = 2m 30s\nb = 2013-02-25 17:07:46 +0100\n", nil, nil},
+	{
+		"top = 1\n[http]\nhost = localhost\n[http.limits] ; nested\nread = 10",
+		"http\n  host = \"localhost\"\n  limits\n    read = 10\ntop = 1\n",
+		nil,
+		nil,
+	},
+	{"a = 1\na = 2", "a = 2\n", []Warning{{"a", "replaced by a later value"}}, nil},
+	{"[a b]\nc = 1", "\"a b\"\n  c = 1\n", nil, nil},
+	{"[a..b]\nc = 1", "", nil, fmt.Errorf(errImportKey, "a..b")},
+	{"[a\nc = 1", "", nil, fmt.Errorf(errINISyntax, 1, "expected ]")},
+	{"\nnonsense", "", nil, fmt.Errorf(errINISyntax, 2, "expected key = value")},
+	{"a = \"open", "", nil, fmt.Errorf(errINISyntax, 1, "invalid quoted string")},
+	{"a = 1\n[a]\nb = 2", "", nil, fmt.Errorf(errImportConflict, "a.b", "a")},
+}
+
+func TestFromINI(t *testing.T) {
+	for _, test := range fromINITests {
+		out, warnings, err := FromINI([]byte(test.in))
+		if string(out) != test.want || !sameWarnings(warnings, test.warnings) || !eq(err, test.err) {
+			t.Errorf("FromINI(%q):", test.in)
+			t.Errorf("   got %q, %v, %v", out, warnings, err)
+			t.Errorf("  want %q, %v, %v", test.want, test.warnings, test.err)
+		}
+	}
+}
+
+var toINITests = []struct {
+	in       map[string]interface{}
+	want     string
+	warnings []Warning
+}{
+	{map[string]interface{}{}, "", nil},
+	{
+		map[string]interface{}{
+			"b":     int64(2),
+			"a":     true,
+			"x.s":   "plain text",
+			"x.n":   "12",
+			"x.c":   "a;b",
+			"x.z.d": 90 * time.Minute,
+			"x.z.t": time.Date(2013, 2, 25, 17, 7, 46, 0, time.FixedZone("", 3600)),
+		},
+		"a = true\nb = 2\n\n[x]\nc = \"a;b\"\nn = \"12\"\ns = plain text\n\n[x.z]\nd = 1h 30m\nt = 2013-02-25 17:07:46 +0100\n",
+		nil,
+	},
+	{
+		map[string]interface{}{
+			"a:b":    int64(1),
+			"c[d].e": int64(2),
+			"f":      []int{},
+		},
+		"",
+		[]Warning{
+			{"a:b", "key cannot be represented in INI"},
+			{"f", "[]int cannot be represented in INI"},
+			{"c[d]", "section name cannot be represented in INI"},
+		},
+	},
+}
+
+func TestToINI(t *testing.T) {
+	for _, test := range toINITests {
+		out, warnings, err := ToINI(&config{data: test.in})
+		if string(out) != test.want || !sameWarnings(warnings, test.warnings) || err != nil {
+			t.Errorf("ToINI(%v):", test.in)
+			t.Errorf("   got %q, %v, %v", out, warnings, err)
+			t.Errorf("  want %q, %v, %v", test.want, test.warnings, nil)
+		}
+	}
+}
+
+func TestINIRoundTripKeys(t *testing.T) {
+	// INI has no quoting, so only segments without dots survive
+	keys := []string{`"a b"`, `c."d e".f`}
+
+	testRoundTripKeys(t, "INI", keys, func(conf Config) ([]byte, error) {
+		doc, _, err := ToINI(conf)
+		if err != nil {
+			return nil, err
+		}
+		src, _, err := FromINI(doc)
+		return src, err
+	})
+}
+
+func TestINIRoundTrip(t *testing.T) {
+	for _, want := range roundTripValues {
+		conf := &config{data: map[string]interface{}{"a.b": want}}
+
+		doc, _, err := ToINI(conf)
+		if err != nil {
+			t.Errorf("ToINI(%#v): %v", want, err)
+			continue
+		}
+
+		src, _, err := FromINI(doc)
+		if err != nil {
+			t.Errorf("FromINI(%s): %v", doc, err)
+			continue
+		}
+
+		out, err := Read(src)
+		if err != nil {
+			t.Errorf("Read(%q): %v", src, err)
+			continue
+		}
+
+		got, _ := out.Get("a.b")
+		if !sameValue(got, want) {
+			t.Errorf("INI round trip of %#v:", want)
+			t.Errorf("   got %#v", got)
+			t.Errorf("  want %#v", want)
+		}
+	}
+}
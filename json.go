@@ -0,0 +1,171 @@
+package walnut
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const (
+	errJSONRoot   = "JSON document must be an object"
+	errJSONType   = "%q cannot be represented in walnut (is %s)"
+	errJSONValue  = "%q cannot be represented in JSON (is %s)"
+	errJSONShape  = "%q collides with a value key in JSON"
+)
+
+// Encodes a Config as a JSON document. Dotted keys are expanded into nested
+// objects, so "http.port" becomes {"http": {"port": ...}}.
+//
+// JSON has no notion of durations, periods, byte sizes, timestamps, dates,
+// times of day, network addresses or URLs, so these are encoded as strings
+// holding their walnut literals, e.g. "1h 30m", "64KiB", "10.0.0.1/8" and
+// "2013-02-25 17:07:46.409 +0100". FromJSON reads such strings back as the
+// original types, so strings which look like one of them, e.g. "5s", are
+// reported as Warnings, as by ToTOML and ToYAML.
+//
+// Floats are always written with a decimal point or exponent to keep them
+// distinct from integers; infinite and NaN floats have no JSON
+// representation and cause an error, as do secrets.
+func ToJSON(conf Config) ([]byte, []Warning, error) {
+	root := make(map[string]interface{})
+	warnings := make([]Warning, 0)
+
+	for _, key := range conf.Keys() {
+		v, _ := conf.Get(key)
+
+		var value interface{}
+
+		switch v := v.(type) {
+		case Null:
+			value = nil
+		case bool, int64:
+			value = v
+		case string:
+			// FromJSON reads e.g. "5s" as a duration
+			if stringLiteral(v) != strconv.Quote(v) {
+				warnings = append(warnings, Warning{key, "string would be read back as another type"})
+			}
+			value = v
+		case float64:
+			if math.IsInf(v, 0) || math.IsNaN(v) {
+				return nil, nil, fmt.Errorf(errJSONValue, key, fmt.Sprint(v))
+			}
+			value = json.Number(formatFloat64(v))
+		case Secret:
+			// neither the reference nor the value belong in the output
+			return nil, nil, fmt.Errorf(errJSONValue, key, "secret")
+		default:
+			s, ok := formatLiteral(v)
+			if !ok {
+				typ := reflect.TypeOf(v).String()
+				return nil, nil, fmt.Errorf(errJSONValue, key, typ)
+			}
+			value = s
+		}
+
+		parts := SplitKey(key)
+		node := root
+
+		for _, part := range parts[:len(parts)-1] {
+			child, ok := node[part]
+			if !ok {
+				child = make(map[string]interface{})
+				node[part] = child
+			}
+
+			if node, ok = child.(map[string]interface{}); !ok {
+				return nil, nil, fmt.Errorf(errJSONShape, key)
+			}
+		}
+
+		node[parts[len(parts)-1]] = value
+	}
+
+	out, err := json.MarshalIndent(root, "", "  ")
+	return out, warnings, err
+}
+
+// Converts a JSON document to walnut source. The document must be an object;
+// nested objects become indented key groups. Names which aren't valid bare
+// keys, e.g. "api.example.com", become quoted key segments.
+//
+// Strings which are valid walnut duration, byte size, timestamp, date or
+// time of day literals (see ToJSON) are converted to those types. Arrays
+// have no walnut equivalent, and are rejected.
+func FromJSON(in []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(in))
+	dec.UseNumber()
+
+	var root interface{}
+	if err := dec.Decode(&root); err != nil {
+		return nil, err
+	}
+
+	obj, ok := root.(map[string]interface{})
+	if !ok {
+		return nil, errors.New(errJSONRoot)
+	}
+
+	table := make(map[string]string)
+	if err := flattenJSON(table, "", obj); err != nil {
+		return nil, err
+	}
+
+	return writeTable(table)
+}
+
+// Recursively populates a table of (key -> literal) pairs from a decoded
+// JSON object.
+func flattenJSON(out map[string]string, prefix string, obj map[string]interface{}) error {
+	for name, v := range obj {
+		key := prefix + quoteKey(name)
+
+		switch v := v.(type) {
+		case map[string]interface{}:
+			if err := flattenJSON(out, key+".", v); err != nil {
+				return err
+			}
+		case bool:
+			out[key] = strconv.FormatBool(v)
+		case json.Number:
+			literal, ok := jsonNumber(v)
+			if !ok {
+				return fmt.Errorf(errJSONType, key, "out of range number "+v.String())
+			}
+			out[key] = literal
+		case string:
+			out[key] = stringLiteral(v)
+		case nil:
+			out[key] = "null"
+		default:
+			return fmt.Errorf(errJSONType, key, "array")
+		}
+	}
+
+	return nil
+}
+
+// Converts a JSON number to either an integer or float literal, depending
+// on whether or not it has a fraction or exponent.
+func jsonNumber(n json.Number) (string, bool) {
+	s := n.String()
+
+	if !strings.ContainsAny(s, ".eE") {
+		if _, err := strconv.ParseInt(s, 10, 64); err != nil {
+			return "", false
+		}
+		return s, true
+	}
+
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return "", false
+	}
+
+	return formatFloat64(f), true
+}
@@ -0,0 +1,304 @@
+package walnut
+
+import (
+	"fmt"
+	"net/netip"
+	"net/url"
+	"testing"
+	"time"
+)
+
+var toJSONTests = []struct {
+	in   string
+	want string
+}{
+	{"", `{}`},
+	{"a = true", `{"a":true}`},
+	{"a = -12", `{"a":-12}`},
+	{"a = 1.0", `{"a":1.0}`},
+	{"a = null", `{"a":null}`},
+	{"a = 0.25", `{"a":0.25}`},
+	{"a = 6.02e23", `{"a":6.02e+23}`},
+	{"a = 1e-7", `{"a":1e-07}`},
+	{"a = \"\\u2603\"", `{"a":"☃"}`},
+	{"a = 2m 30s", `{"a":"2m 30s"}`},
+	{"a = 1w 36h", `{"a":"1w 1d 12h"}`},
+	{"a = 750ms", `{"a":"750ms"}`},
+	{"a = 2013-02-25 17:07:46.409 +0100", `{"a":"2013-02-25 17:07:46.409 +0100"}`},
+	{"a = 2013-02-25 17:07:46 Europe/Berlin", `{"a":"2013-02-25 17:07:46 Europe/Berlin"}`},
+	{"a = 1979-05-27T07:32:00Z", `{"a":"1979-05-27 07:32:00 +0000"}`},
+	{"a = 2013-02-25", `{"a":"2013-02-25"}`},
+	{"a = 22:30", `{"a":"22:30:00"}`},
+	{"a.b = 1\na.c = 2", `{"a":{"b":1,"c":2}}`},
+	{"a\n  b\n    c = 1\n  d = 2", `{"a":{"b":{"c":1},"d":2}}`},
+}
+
+func TestToJSON(t *testing.T) {
+	for _, test := range toJSONTests {
+		conf, err := Read([]byte(test.in))
+		if err != nil {
+			t.Fatalf("Read(%q): %v", test.in, err)
+		}
+
+		out, _, err := ToJSON(conf)
+		if got := compact(out); got != test.want || err != nil {
+			t.Errorf("ToJSON(%q):", test.in)
+			t.Errorf("   got %s, %v", got, err)
+			t.Errorf("  want %s, %v", test.want, nil)
+		}
+	}
+}
+
+func TestToJSONSpecialFloats(t *testing.T) {
+	for _, in := range []string{"a = inf", "a = -inf", "a = nan"} {
+		conf, err := Read([]byte(in))
+		if err != nil {
+			t.Fatalf("Read(%q): %v", in, err)
+		}
+
+		if out, _, err := ToJSON(conf); err == nil {
+			t.Errorf("ToJSON(%q):", in)
+			t.Errorf("   got %s, %v", out, err)
+			t.Errorf("  want an error")
+		}
+	}
+}
+
+var toJSONErrorTests = []struct {
+	conf *config
+	err  error
+}{
+	{
+		&config{data: map[string]interface{}{"db.password": Secret{"db", "hunter2"}}},
+		fmt.Errorf(errJSONValue, "db.password", "secret"),
+	},
+}
+
+func TestToJSONErrors(t *testing.T) {
+	for _, test := range toJSONErrorTests {
+		if out, _, err := ToJSON(test.conf); !eq(err, test.err) {
+			t.Errorf("ToJSON(%v):", test.conf.data)
+			t.Errorf("   got %s, %v", out, err)
+			t.Errorf("  want %v", test.err)
+		}
+	}
+}
+
+// Strings which look like other types are read back as those types, so
+// they must be warned about.
+func TestJSONAmbiguousStrings(t *testing.T) {
+	for _, s := range []string{"5s", "10.0.0.1", "https://example.com/", "hello", "true"} {
+		conf := &config{data: map[string]interface{}{"a": s}}
+
+		js, warnings, err := ToJSON(conf)
+		if err != nil {
+			t.Fatalf("ToJSON(%q): %v", s, err)
+		}
+
+		src, err := FromJSON(js)
+		if err != nil {
+			t.Fatalf("FromJSON(%s): %v", js, err)
+		}
+
+		out, err := Read(src)
+		if err != nil {
+			t.Fatalf("Read(%q): %v", src, err)
+		}
+
+		got, _ := out.Get("a")
+		if changed := got != s; changed != (len(warnings) > 0) {
+			t.Errorf("JSON round trip of %q:", s)
+			t.Errorf("   got %#v with warnings %v", got, warnings)
+		}
+	}
+}
+
+var fromJSONTests = []struct {
+	in   string
+	want string
+	err  error
+}{
+	{`{}`, "", nil},
+	{`{"a":true}`, "a = true\n", nil},
+	{`{"a":12}`, "a = 12\n", nil},
+	{`{"a":12.0}`, "a = 12.0\n", nil},
+	{`{"a":1e3}`, "a = 1000.0\n", nil},
+	{`{"a":"hi"}`, "a = \"hi\"\n", nil},
+	{`{"a":"5s"}`, "a = 5s\n", nil},
+	{`{"a":"5 s"}`, "a = \"5 s\"\n", nil},
+	{`{"a":"1970-01-01 00:00:00 +0000"}`, "a = 1970-01-01 00:00:00 +0000\n", nil},
+	{`{"a":"1970-01-01T00:00:00Z"}`, "a = 1970-01-01T00:00:00Z\n", nil},
+	{`{"a":"2013-02-25"}`, "a = 2013-02-25\n", nil},
+	{`{"a":"22:30"}`, "a = 22:30\n", nil},
+	{`{"a":"2013-02-30"}`, "a = \"2013-02-30\"\n", nil},
+	{`{"b":{"d":2,"c":{"e":3}},"a":1}`, "a = 1\nb\n  c\n    e = 3\n  d = 2\n", nil},
+	{`[]`, "", fmt.Errorf(errJSONRoot)},
+	{`{"a":null}`, "a = null\n", nil},
+	{`{"a":{"b":[1]}}`, "", fmt.Errorf(errJSONType, "a.b", "array")},
+	{`{"a b":1}`, "\"a b\" = 1\n", nil},
+	{`{"a.b":{"c":1}}`, "\"a.b\"\n  c = 1\n", nil},
+	{`{"":1}`, "\"\" = 1\n", nil},
+	{`{"a":9223372036854775808}`, "", fmt.Errorf(errJSONType, "a", "out of range number 9223372036854775808")},
+}
+
+func TestFromJSON(t *testing.T) {
+	for _, test := range fromJSONTests {
+		out, err := FromJSON([]byte(test.in))
+		if string(out) != test.want || !eq(err, test.err) {
+			t.Errorf("FromJSON(%q):", test.in)
+			t.Errorf("   got %q, %v", out, err)
+			t.Errorf("  want %q, %v", test.want, test.err)
+		}
+	}
+}
+
+var roundTripValues = []interface{}{
+	true,
+	false,
+	int64(0),
+	int64(-1 << 63),
+	int64(1<<63 - 1),
+	float64(0),
+	float64(-12.5),
+	float64(1e23),
+	float64(22.22222222222222),
+	float64(1e-7),
+	float64(-6.02e300),
+	"",
+	"hello",
+	"\"quoted\"\n\t\u2603",
+	time.Duration(0),
+	90 * time.Minute,
+	time.Duration(1<<63 - 1),
+	-90 * time.Minute,
+	time.Duration(-1 << 63),
+	Date{2013, time.February, 25},
+	TimeOfDay{22, 30, 0, 0},
+	TimeOfDay{6, 15, 30, 500},
+	Period{1, 6, 0},
+	Period{0, 0, 10},
+	Period{-2, 0, -1},
+	ByteSize(0),
+	ByteSize(1536),
+	ByteSize(1500000000),
+	ByteSize(1<<63 - 1),
+	time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC),
+	time.Date(2013, 2, 25, 17, 7, 46, 409000000, time.FixedZone("", 3600)),
+	time.Date(2012, 1, 2, 15, 30, 28, 789, time.FixedZone("", -5400)),
+	time.Date(2013, 7, 25, 17, 7, 46, 0, berlin),
+	netip.MustParseAddr("10.0.0.1"),
+	netip.MustParseAddr("fe80::1"),
+	netip.MustParsePrefix("10.0.0.0/8"),
+	netip.MustParseAddrPort("[::1]:8080"),
+	mustParseURL("https://user@example.com:8443/a/b?c=d#e"),
+}
+
+func mustParseURL(s string) *url.URL {
+	u, err := url.Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return u
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	for _, want := range roundTripValues {
+		conf := &config{data: map[string]interface{}{"a.b": want}}
+
+		js, _, err := ToJSON(conf)
+		if err != nil {
+			t.Errorf("ToJSON(%#v): %v", want, err)
+			continue
+		}
+
+		src, err := FromJSON(js)
+		if err != nil {
+			t.Errorf("FromJSON(%s): %v", js, err)
+			continue
+		}
+
+		out, err := Read(src)
+		if err != nil {
+			t.Errorf("Read(%q): %v", src, err)
+			continue
+		}
+
+		got, _ := out.Get("a.b")
+		if !sameValue(got, want) {
+			t.Errorf("JSON round trip of %#v:", want)
+			t.Errorf("   got %#v", got)
+			t.Errorf("  want %#v", want)
+		}
+	}
+}
+
+func TestJSONRoundTripKeys(t *testing.T) {
+	testRoundTripKeys(t, "JSON", quotedKeys, func(conf Config) ([]byte, error) {
+		js, _, err := ToJSON(conf)
+		if err != nil {
+			return nil, err
+		}
+		return FromJSON(js)
+	})
+}
+
+// Keys with quoted segments, which conversions must keep intact.
+var quotedKeys = []string{
+	`backends."api.example.com".weight`,
+	`"a b"`,
+	`c."d e".f`,
+}
+
+// Checks that converting a Config with the given keys to another format and
+// back yields walnut source with the same keys.
+func testRoundTripKeys(t *testing.T, format string, keys []string, convert func(Config) ([]byte, error)) {
+	t.Helper()
+
+	conf := &config{data: make(map[string]interface{})}
+	for i, key := range keys {
+		conf.data[key] = int64(i)
+	}
+
+	src, err := convert(conf)
+	if err != nil {
+		t.Fatalf("%s round trip of %q: %v", format, keys, err)
+	}
+
+	out, err := Read(src)
+	if err != nil {
+		t.Fatalf("Read(%q): %v", src, err)
+	}
+
+	if got := out.Keys(); !eq(got, conf.Keys()) {
+		t.Errorf("%s round trip of %q:", format, keys)
+		t.Errorf("   got %q", got)
+		t.Errorf("  want %q", conf.Keys())
+	}
+}
+
+// Strips the indentation from ToJSON's output.
+func compact(in []byte) string {
+	out := make([]byte, 0, len(in))
+	quoted := false
+
+	for i := 0; i < len(in); i++ {
+		switch b := in[i]; {
+		case b == '"' && (i == 0 || in[i-1] != '\\'):
+			quoted = !quoted
+		case !quoted && (b == ' ' || b == '\n'):
+			continue
+		}
+		out = append(out, in[i])
+	}
+
+	return string(out)
+}
+
+// Like eq, but compares timestamps using time.Time.Equal.
+func sameValue(a, b interface{}) bool {
+	if t, ok := a.(time.Time); ok {
+		u, ok := b.(time.Time)
+		return ok && t.Equal(u)
+	}
+	return eq(a, b)
+}
@@ -0,0 +1,100 @@
+package walnut
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Joins key segments into a single key, in the form used by Keys, Get,
+// Select and the other Config methods. Segments which can't be written as
+// bare keys, e.g. because they contain dots or whitespace, are quoted.
+//     JoinKey("backends", "api.example.com", "weight")
+//     // -> `backends."api.example.com".weight`
+func JoinKey(segments ...string) string {
+	parts := make([]string, len(segments))
+	for i, s := range segments {
+		parts[i] = quoteKey(s)
+	}
+
+	return strings.Join(parts, ".")
+}
+
+// Splits a key into its segments, unquoting any quoted ones; the inverse of
+// JoinKey. A malformed key, e.g. one with an unterminated quote, is returned
+// as a single segment.
+func SplitKey(key string) []string {
+	segments, ok := splitKey(key)
+	if !ok {
+		return []string{key}
+	}
+
+	return segments
+}
+
+// Quotes a key segment, unless it can be written as a bare key.
+func quoteKey(s string) string {
+	if isValidKey(s) {
+		return s
+	}
+	return strconv.Quote(s)
+}
+
+// Splits a key as written in a configuration file into its segments.
+// Segments are separated by dots, and are either bare or double-quoted Go
+// string literals. Returns false if the key is malformed, e.g. if it has an
+// empty bare segment, or a bare one ending in "[]".
+func splitKey(key string) ([]string, bool) {
+	segments := make([]string, 0)
+
+	for {
+		var segment string
+		var n int
+
+		if strings.HasPrefix(key, `"`) {
+			if segment, n = readString(key); n == 0 {
+				return nil, false
+			}
+		} else {
+			if n = strings.IndexAny(key, `."`); n < 0 {
+				n = len(key)
+			}
+			if n == 0 || strings.HasSuffix(key[:n], "[]") {
+				return nil, false
+			}
+			segment = key[:n]
+		}
+
+		segments = append(segments, segment)
+		key = key[n:]
+
+		switch {
+		case key == "":
+			return segments, true
+		case key[0] != '.':
+			return nil, false
+		}
+
+		key = key[1:]
+	}
+}
+
+// Converts a key as written in a configuration file to its canonical form,
+// so that e.g. `a."b"` and `a.b` refer to the same key. Returns false if the
+// key is malformed.
+func parseKey(key string) (string, bool) {
+	segments, ok := splitKey(key)
+	if !ok {
+		return "", false
+	}
+
+	return JoinKey(segments...), true
+}
+
+// Splits a key into its parent group and its last segment. The group is
+// empty for top-level keys.
+func splitLast(key string) (string, string) {
+	segments := SplitKey(key)
+	last := len(segments) - 1
+
+	return JoinKey(segments[:last]...), quoteKey(segments[last])
+}
@@ -0,0 +1,138 @@
+package walnut
+
+import (
+	"strings"
+	"testing"
+)
+
+var joinKeyTests = []struct {
+	in   []string
+	want string
+}{
+	{[]string{"a"}, "a"},
+	{[]string{"a", "b", "c"}, "a.b.c"},
+	{[]string{"backends", "api.example.com", "weight"}, `backends."api.example.com".weight`},
+	{[]string{"my label"}, `"my label"`},
+	{[]string{"a=b", "#c"}, `"a=b"."#c"`},
+	{[]string{`say "hi"`}, `"say \"hi\""`},
+	{[]string{""}, `""`},
+	{[]string{"♫"}, "♫"},
+}
+
+func TestJoinKey(t *testing.T) {
+	for _, test := range joinKeyTests {
+		got := JoinKey(test.in...)
+		if got != test.want {
+			t.Errorf("JoinKey(%q):", test.in)
+			t.Errorf("   got %s", got)
+			t.Errorf("  want %s", test.want)
+		}
+
+		if back := SplitKey(got); !eq(back, test.in) {
+			t.Errorf("SplitKey(%s):", got)
+			t.Errorf("   got %q", back)
+			t.Errorf("  want %q", test.in)
+		}
+	}
+}
+
+var splitKeyTests = []struct {
+	in   string
+	want []string
+	ok   bool
+}{
+	{"a", []string{"a"}, true},
+	{"a.b", []string{"a", "b"}, true},
+	{`a."b.c".d`, []string{"a", "b.c", "d"}, true},
+	{`"a"."b"`, []string{"a", "b"}, true},
+	{`"a\tb"`, []string{"a\tb"}, true},
+	{"", nil, false},
+	{"a.", nil, false},
+	{".a", nil, false},
+	{"a..b", nil, false},
+	{`a."b`, nil, false},
+	{`a"b"`, nil, false},
+	{`"a"b`, nil, false},
+}
+
+func TestSplitKey(t *testing.T) {
+	for _, test := range splitKeyTests {
+		got, ok := splitKey(test.in)
+		if !eq(got, test.want) || ok != test.ok {
+			t.Errorf("splitKey(%q):", test.in)
+			t.Errorf("   got %q, %v", got, ok)
+			t.Errorf("  want %q, %v", test.want, test.ok)
+		}
+	}
+}
+
+func TestParseKeyCanonical(t *testing.T) {
+	for _, in := range []string{`a."b"`, `"a".b`, `"a"."b"`} {
+		if got, _ := parseKey(in); got != "a.b" {
+			t.Errorf("parseKey(%q): got %q, want %q", in, got, "a.b")
+		}
+	}
+}
+
+func TestQuotedKeys(t *testing.T) {
+	src := []byte(`backends
+  "api.example.com"
+    weight = 2
+  "db.example.com".weight = 1
+  plain.weight = 3
+`)
+
+	conf, err := Read(src)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+
+	backends := conf.Select("backends")
+	want := []string{`"api.example.com".weight`, `"db.example.com".weight`, "plain.weight"}
+	if got := backends.Keys(); !eq(got, want) {
+		t.Errorf("Config.Keys():")
+		t.Errorf("   got %q", got)
+		t.Errorf("  want %q", want)
+	}
+
+	// "api" must not match "api.example.com"
+	if got := backends.Select("api").Keys(); len(got) != 0 {
+		t.Errorf("Config.Select(\"api\").Keys(): got %q, want none", got)
+	}
+
+	if got := backends.Select(JoinKey("api.example.com")).Int64("weight"); got != 2 {
+		t.Errorf("weight of api.example.com: got %d, want 2", got)
+	}
+
+	if _, err := Read([]byte("a.b = 1\na.\"b\" = 2")); err == nil {
+		t.Errorf(`Read: a.b and a."b" should collide`)
+	}
+
+	// the keys survive being written back out
+	keys := conf.Keys()
+	literals := make([]string, len(keys))
+	for i, key := range keys {
+		v, _ := conf.Get(key)
+		literals[i], _ = formatLiteral(v)
+	}
+
+	out := writeTree(keys, literals)
+	again, err := Read(out)
+	if err != nil {
+		t.Fatalf("Read(%q): %v", out, err)
+	}
+	if got := again.Keys(); !eq(got, keys) {
+		t.Errorf("Read(writeTree(...)).Keys():")
+		t.Errorf("   got %q", got)
+		t.Errorf("  want %q", keys)
+	}
+
+	js, _, err := ToJSON(conf)
+	if err != nil {
+		t.Fatalf("ToJSON: %v", err)
+	}
+	want = []string{`"api.example.com":{"weight":2}`}
+	if !strings.Contains(compact(js), want[0]) {
+		t.Errorf("ToJSON: got %s, want it to contain %s", compact(js), want[0])
+	}
+}
@@ -1,6 +1,10 @@
 package walnut
 
 import (
+	"fmt"
+	"math/big"
+	"net/netip"
+	"net/url"
 	"regexp"
 	"strconv"
 	"strings"
@@ -8,10 +12,18 @@ import (
 )
 
 var (
-	reInt   = regexp.MustCompile(`^[\+\-]?\d+`)
-	reFloat = regexp.MustCompile(`^[\+\-]?\d+\.\d+`)
-	reTime  = regexp.MustCompile(
-		`^\d{4}\-\d{2}\-\d{2} \d{2}:\d{2}:\d{2}(?:\.\d+)? [\-\+]\d{4}`)
+	reFloat = regexp.MustCompile(
+		`^[\+\-]?(?:\d+\.\d+(?:[eE][\+\-]?\d+)?|\d+[eE][\+\-]?\d+)`)
+	reTime = regexp.MustCompile(
+		`^\d{4}\-\d{2}\-\d{2} \d{2}:\d{2}:\d{2}(?:\.\d+)? ` +
+			`([\-\+]\d{4}|[A-Za-z][\w\+\-]*(?:/[\w\+\-]+)*)`)
+	reRFC3339 = regexp.MustCompile(
+		`^\d{4}\-\d{2}\-\d{2}T\d{2}:\d{2}:\d{2}(?:\.\d+)?(?:Z|[\-\+]\d{2}:\d{2})`)
+	reDate      = regexp.MustCompile(`^(\d{4})\-(\d{2})\-(\d{2})`)
+	reTimeOfDay = regexp.MustCompile(`^(\d{2}):(\d{2})(?::(\d{2})(?:\.(\d{1,9}))?)?`)
+	reBytes     = regexp.MustCompile(`^(\d+)(?:\.(\d+))?([KMGTPE]i?)?B`)
+	reURL       = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9\+\-\.]*://`)
+	rePeriod    = regexp.MustCompile(`^([\+\-]?)P(?:(\d+)Y)?(?:(\d+)M)?(?:(\d+)W)?(?:(\d+)D)?`)
 )
 
 const maxDuration = 1<<63 - 1
@@ -29,25 +41,122 @@ func readBool(in string) (bool, int) {
 	return false, 0
 }
 
+// The value of keys explicitly set to "null". Such keys are defined, but
+// hold no value; when Configs are merged, they remove the key from the
+// Configs beneath them.
+type Null struct{}
+
+// Attempts to extract a null from the beginning of
+// the input string.
+func readNull(in string) (Null, int) {
+	if strings.HasPrefix(in, "null") {
+		return Null{}, 4
+	}
+
+	return Null{}, 0
+}
+
 // Attempts to extract an integer from the beginning of
 // the input string.
 func readInt64(in string) (int64, int) {
-	m := reInt.FindStringSubmatchIndex(in)
-	if m == nil {
+	v, n, err := scanInt64(in)
+	if err != nil {
 		return 0, 0
 	}
 
-	v, err := strconv.ParseInt(in[m[0]:m[1]], 10, 64)
+	return v, n
+}
+
+var intBases = []struct {
+	prefix string
+	base   int
+	name   string
+}{
+	{"0x", 16, "hexadecimal"},
+	{"0o", 8, "octal"},
+	{"0b", 2, "binary"},
+}
+
+// Scans an integer at the beginning of `in`: an optional sign followed by
+// either base-10 digits, or one of the prefixes in intBases and digits in
+// that base. Digits may be separated by single underscores.
+//
+// If the input starts with something that looks like an integer but isn't
+// a valid one, e.g. "0x", "1__000" or "0755", an error describing the
+// problem is returned, along with the length of the offending token.
+func scanInt64(in string) (int64, int, error) {
+	n := 0
+	if n < len(in) && (in[n] == '+' || in[n] == '-') {
+		n++
+	}
+	if n == len(in) || !isDigit(in[n], 10) {
+		return 0, 0, nil
+	}
+
+	sign := in[:n]
+	base, name := 10, "decimal"
+
+	for _, b := range intBases {
+		if strings.HasPrefix(in[n:], b.prefix) {
+			base, name = b.base, b.name
+			n += len(b.prefix)
+			break
+		}
+	}
+
+	start := n
+	for n < len(in) && (isDigit(in[n], base) || in[n] == '_') {
+		n++
+	}
+
+	digits := in[start:n]
+
+	switch {
+	case digits == "":
+		return 0, n, fmt.Errorf("missing digits after %q", in[start-2:start])
+	case digits[0] == '_' || digits[len(digits)-1] == '_' || strings.Contains(digits, "__"):
+		return 0, n, fmt.Errorf("underscores must separate digits")
+	case base == 10 && len(digits) > 1 && digits[0] == '0':
+		return 0, n, fmt.Errorf("leading zeros are ambiguous, use 0o for octal")
+	case n < len(in) && isDigit(in[n], 10):
+		return 0, n + 1, fmt.Errorf("invalid digit %q in %s literal", in[n], name)
+	}
+
+	v, err := strconv.ParseInt(sign+strings.Replace(digits, "_", "", -1), base, 64)
 	if err != nil {
-		return 0, 0
+		return 0, n, fmt.Errorf("%s is out of range", in[:n])
 	}
 
-	return v, m[1]
+	return v, n, nil
+}
+
+// Reports whether b is a valid digit in the given base (up to 16).
+func isDigit(b byte, base int) bool {
+	switch {
+	case '0' <= b && b <= '9':
+		return int(b-'0') < base
+	case 'a' <= b && b <= 'f':
+		return int(b-'a')+10 < base
+	case 'A' <= b && b <= 'F':
+		return int(b-'A')+10 < base
+	}
+
+	return false
 }
 
 // Attempts to extract a floating point value from the
-// beginning of the input string.
+// beginning of the input string. Besides decimal fractions
+// with an optional exponent ("6.02e23") and plain exponents
+// ("1e-6"), the special values "inf", "-inf" and "nan" are
+// accepted. Values too large for a float64 are rejected.
 func readFloat64(in string) (float64, int) {
+	for _, special := range []string{"inf", "+inf", "-inf", "nan"} {
+		if strings.HasPrefix(in, special) {
+			v, _ := strconv.ParseFloat(special, 64)
+			return v, len(special)
+		}
+	}
+
 	m := reFloat.FindStringSubmatchIndex(in)
 	if m == nil {
 		return 0, 0
@@ -99,38 +208,57 @@ func readString(s string) (string, int) {
 	return v, end + 1
 }
 
-// Attempts to extract a timestamp from the beginning of `in`.
+// Attempts to extract a duration from the beginning of `in`. The duration
+// may be preceded by a sign, which applies to all of its components, and
+// each component's value may have a fraction, e.g. "-1.5h" or "1m 2.5s".
 func readDuration(in string) (time.Duration, int) {
-	var total, prev time.Duration
+	var prev time.Duration
 	var offset int
 
+	negative := false
+	if len(in) > 1 && (in[0] == '-' || in[0] == '+') && isDigit(in[1], 10) {
+		negative = in[0] == '-'
+		offset++
+	}
+
+	total := new(big.Int)
+
 	for {
 		num, unit, n := readDurationPartial(in[offset:])
 		if n == 0 {
 			break
 		}
 
-		switch {
 		// units must appear in descending order (greatest first),
 		// and only once each
-		case prev != 0 && unit >= prev:
-			return 0, 0
-		// make sure this component doesn't single-handedly overflow
-		// time.Duration values
-		case num > 0 && unit > maxDuration/num:
-			return 0, 0
-		// would adding this component to the current total cause it
-		// to overflow?
-		case num*unit > maxDuration-total:
+		if prev != 0 && unit >= prev {
 			return 0, 0
 		}
 
 		offset += n
-		total += num * unit
+		total.Add(total, num)
 		prev = unit
 	}
 
-	return total, offset
+	if prev == 0 {
+		return 0, 0
+	}
+
+	// make sure the total fits in a time.Duration, which can hold one
+	// more negative nanosecond than positive ones
+	limit := big.NewInt(maxDuration)
+	if negative {
+		limit.Add(limit, big.NewInt(1))
+	}
+	if total.Cmp(limit) > 0 {
+		return 0, 0
+	}
+
+	if negative {
+		total.Neg(total)
+	}
+
+	return time.Duration(total.Int64()), offset
 }
 
 var durations = []struct {
@@ -149,42 +277,463 @@ var durations = []struct {
 	{"w", 7 * 24 * time.Hour},
 }
 
-func readDurationPartial(in string) (num, unit time.Duration, n int) {
+// Reads a single (value, unit) pair, along with any whitespace preceding
+// it. Returns the pair's value in nanoseconds, truncated towards zero, its
+// unit and its length.
+func readDurationPartial(in string) (*big.Int, time.Duration, int) {
+	n := 0
+
 	// skip whitespace
 	for n < len(in) && strings.ContainsRune(Space, rune(in[n])) {
 		n++
 	}
 
 	s := n
-	for n < len(in) && ('0' <= in[n] && in[n] <= '9') {
+	for n < len(in) && isDigit(in[n], 10) {
 		n++
 	}
+	if n == s {
+		return nil, 0, 0
+	}
 
-	unsigned, err := strconv.ParseUint(in[s:n], 10, 63)
-	if err != nil {
-		return 0, 0, 0
+	digits := in[s:n]
+	places := 0
+
+	// a fraction needs digits on either side of the decimal point
+	if n+1 < len(in) && in[n] == '.' && isDigit(in[n+1], 10) {
+		f := n + 1
+		for n = f; n < len(in) && isDigit(in[n], 10); n++ {
+		}
+		digits += in[f:n]
+		places = n - f
 	}
 
 	for _, unit := range durations {
 		if strings.HasPrefix(in[n:], unit.name) {
-			return time.Duration(unsigned), unit.value, n + len(unit.name)
+			// (digits * unit) / 10^places
+			v, _ := new(big.Int).SetString(digits, 10)
+			v.Mul(v, big.NewInt(int64(unit.value)))
+			v.Quo(v, new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(places)), nil))
+
+			return v, unit.value, n + len(unit.name)
 		}
 	}
 
-	return 0, 0, 0
+	return nil, 0, 0
+}
+
+// A calendar period, as expressed by literals such as "1y 6mo" or "P1Y6M".
+// Unlike durations, periods don't have a fixed length: a month may have
+// anywhere between 28 and 31 days.
+type Period struct {
+	Years  int
+	Months int
+	Days   int
 }
 
-// Attempts to extract a timestamp from the beginning of `in`.
+// Returns the time the period after t, as calculated by time.Time.AddDate.
+func (p Period) AddTo(t time.Time) time.Time {
+	return t.AddDate(p.Years, p.Months, p.Days)
+}
+
+var periods = []struct {
+	name string
+	iso  string
+	set  func(p *Period, n int)
+}{
+	{"y", "Y", func(p *Period, n int) { p.Years = n }},
+	{"mo", "M", func(p *Period, n int) { p.Months = n }},
+	{"w", "W", func(p *Period, n int) { p.Days += 7 * n }},
+	{"d", "D", func(p *Period, n int) { p.Days += n }},
+}
+
+// Attempts to extract a period from the beginning of `in`. Periods consist
+// of (value, unit) pairs like durations, but with "y", "mo", "w" and "d" as
+// units, at least one of which must be years or months to tell them apart
+// from durations. ISO 8601 periods without a time part, e.g. "P1Y2M10D",
+// are accepted too. Either form may be preceded by a sign.
+func readPeriod(in string) (Period, int) {
+	if m := rePeriod.FindStringSubmatch(in); m != nil {
+		return readISOPeriod(m)
+	}
+
+	var p Period
+	var offset int
+
+	sign := 1
+	if len(in) > 1 && (in[0] == '-' || in[0] == '+') && isDigit(in[1], 10) {
+		if in[0] == '-' {
+			sign = -1
+		}
+		offset++
+	}
+
+	// whether the period has years or months, even if they're zero
+	calendar := false
+
+	next := 0
+	for next < len(periods) {
+		n := offset
+		for n < len(in) && strings.ContainsRune(Space, rune(in[n])) {
+			n++
+		}
+
+		s := n
+		for n < len(in) && isDigit(in[n], 10) {
+			n++
+		}
+
+		num, err := strconv.ParseInt(in[s:n], 10, 32)
+		if err != nil {
+			break
+		}
+
+		// units must appear in descending order, and only once each
+		i := next
+		for i < len(periods) && !strings.HasPrefix(in[n:], periods[i].name) {
+			i++
+		}
+		if i == len(periods) {
+			break
+		}
+
+		periods[i].set(&p, sign*int(num))
+		offset = n + len(periods[i].name)
+		next = i + 1
+		calendar = calendar || i < 2
+	}
+
+	// without years or months, this is either a duration or nothing
+	if !calendar {
+		return Period{}, 0
+	}
+
+	return p, offset
+}
+
+// Converts a match of rePeriod to a Period.
+func readISOPeriod(m []string) (Period, int) {
+	var p Period
+
+	sign := 1
+	if m[1] == "-" {
+		sign = -1
+	}
+
+	found := false
+	for i, unit := range periods {
+		if m[i+2] == "" {
+			continue
+		}
+
+		num, err := strconv.ParseInt(m[i+2], 10, 32)
+		if err != nil {
+			return Period{}, 0
+		}
+
+		unit.set(&p, sign*int(num))
+		found = true
+	}
+
+	if !found {
+		return Period{}, 0
+	}
+
+	return p, len(m[0])
+}
+
+// A number of bytes, as expressed by size literals such as "64KiB".
+type ByteSize int64
+
+var byteSizes = []struct {
+	name  string
+	value int64
+}{
+	{"", 1},
+	{"K", 1e3},
+	{"M", 1e6},
+	{"G", 1e9},
+	{"T", 1e12},
+	{"P", 1e15},
+	{"E", 1e18},
+	{"Ki", 1 << 10},
+	{"Mi", 1 << 20},
+	{"Gi", 1 << 30},
+	{"Ti", 1 << 40},
+	{"Pi", 1 << 50},
+	{"Ei", 1 << 60},
+}
+
+// Attempts to extract a byte size from the beginning of `in`. The size may
+// have a fraction, as long as the resulting number of bytes is a whole
+// number; "1.5KiB" is fine, "1.5B" is not.
+func readBytes(in string) (ByteSize, int) {
+	m := reBytes.FindStringSubmatchIndex(in)
+	if m == nil {
+		return 0, 0
+	}
+
+	digits := in[m[2]:m[3]]
+	places := 0
+	if m[4] >= 0 {
+		digits += in[m[4]:m[5]]
+		places = m[5] - m[4]
+	}
+
+	unit := int64(1)
+	for _, u := range byteSizes {
+		if m[6] >= 0 && u.name == in[m[6]:m[7]] {
+			unit = u.value
+		}
+	}
+
+	// (digits * unit) / 10^places, which must be a whole number
+	n, _ := new(big.Int).SetString(digits, 10)
+	n.Mul(n, big.NewInt(unit))
+
+	div := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(places)), nil)
+	n, rem := n.QuoRem(n, div, new(big.Int))
+
+	if rem.Sign() != 0 || !n.IsInt64() {
+		return 0, 0
+	}
+
+	return ByteSize(n.Int64()), m[1]
+}
+
+// Attempts to extract a timestamp from the beginning of `in`. Timestamps are
+// either in the "2006-01-02 15:04:05 -0700" format, with the offset possibly
+// replaced by an IANA zone name such as "Europe/Berlin", or in RFC 3339
+// format.
 func readTime(in string) (time.Time, int) {
+	if m := reRFC3339.FindStringIndex(in); m != nil {
+		v, err := time.Parse(time.RFC3339Nano, in[:m[1]])
+		if err != nil {
+			return time.Time{}, 0
+		}
+
+		return v, m[1]
+	}
+
 	m := reTime.FindStringSubmatchIndex(in)
 	if m == nil {
 		return time.Time{}, 0
 	}
 
-	v, err := time.Parse("2006-01-02 15:04:05 -0700", in[m[0]:m[1]])
+	zone := in[m[2]:m[3]]
+
+	if zone[0] == '-' || zone[0] == '+' {
+		v, err := time.Parse("2006-01-02 15:04:05 -0700", in[:m[1]])
+		if err != nil {
+			return time.Time{}, 0
+		}
+
+		return v, m[1]
+	}
+
+	// the local zone depends on the machine reading the file, which would
+	// make the timestamp ambiguous
+	if zone == "Local" {
+		return time.Time{}, 0
+	}
+
+	loc, err := time.LoadLocation(zone)
+	if err != nil {
+		return time.Time{}, 0
+	}
+
+	v, err := time.ParseInLocation("2006-01-02 15:04:05", in[:m[2]-1], loc)
 	if err != nil {
 		return time.Time{}, 0
 	}
 
 	return v, m[1]
 }
+
+// A calendar date without a time or zone, as expressed by literals such as
+// "2013-02-25".
+type Date struct {
+	Year  int
+	Month time.Month
+	Day   int
+}
+
+// Returns the time at the start of the date in the given location.
+func (d Date) In(loc *time.Location) time.Time {
+	return time.Date(d.Year, d.Month, d.Day, 0, 0, 0, 0, loc)
+}
+
+// Attempts to extract a date from the beginning of `in`.
+func readDate(in string) (Date, int) {
+	m := reDate.FindStringSubmatch(in)
+	if m == nil {
+		return Date{}, 0
+	}
+
+	t, err := time.Parse("2006-01-02", m[0])
+	if err != nil {
+		return Date{}, 0
+	}
+
+	return Date{t.Year(), t.Month(), t.Day()}, len(m[0])
+}
+
+// A time of day without a date or zone, as expressed by literals such as
+// "22:30" or "06:15:30.5".
+type TimeOfDay struct {
+	Hour       int
+	Minute     int
+	Second     int
+	Nanosecond int
+}
+
+// Returns the time of day on the given date, in the given location.
+func (t TimeOfDay) On(d Date, loc *time.Location) time.Time {
+	return time.Date(d.Year, d.Month, d.Day, t.Hour, t.Minute, t.Second, t.Nanosecond, loc)
+}
+
+// Attempts to extract a time of day from the beginning of `in`. Seconds and
+// their fraction are optional.
+func readTimeOfDay(in string) (TimeOfDay, int) {
+	m := reTimeOfDay.FindStringSubmatch(in)
+	if m == nil {
+		return TimeOfDay{}, 0
+	}
+
+	var v TimeOfDay
+	v.Hour, _ = strconv.Atoi(m[1])
+	v.Minute, _ = strconv.Atoi(m[2])
+	if m[3] != "" {
+		v.Second, _ = strconv.Atoi(m[3])
+	}
+	if m[4] != "" {
+		// pad the fraction to nanoseconds
+		v.Nanosecond, _ = strconv.Atoi(m[4] + strings.Repeat("0", 9-len(m[4])))
+	}
+
+	if v.Hour > 23 || v.Minute > 59 || v.Second > 59 {
+		return TimeOfDay{}, 0
+	}
+
+	return v, len(m[0])
+}
+
+// Returns the token at the beginning of `in` which may hold a network
+// address: everything up to the first whitespace, comment, or comma or
+// brace ending an inline map entry.
+func addrToken(in string) string {
+	for i := 0; i < len(in); i++ {
+		if strings.ContainsRune("#,}", rune(in[i])) || strings.ContainsRune(Space, rune(in[i])) {
+			return in[:i]
+		}
+	}
+	return in
+}
+
+// Attempts to extract an IP address, e.g. "10.0.0.1" or "::1", from the
+// beginning of `in`.
+func readAddr(in string) (netip.Addr, int) {
+	token := addrToken(in)
+
+	v, err := netip.ParseAddr(token)
+	if err != nil {
+		return netip.Addr{}, 0
+	}
+
+	return v, len(token)
+}
+
+// Attempts to extract an IP network prefix, e.g. "10.0.0.0/8", from the
+// beginning of `in`.
+func readPrefix(in string) (netip.Prefix, int) {
+	token := addrToken(in)
+
+	v, err := netip.ParsePrefix(token)
+	if err != nil {
+		return netip.Prefix{}, 0
+	}
+
+	return v, len(token)
+}
+
+// Attempts to extract an IP address and port, e.g. "10.0.0.1:80" or
+// "[::1]:80", from the beginning of `in`.
+func readAddrPort(in string) (netip.AddrPort, int) {
+	token := addrToken(in)
+
+	v, err := netip.ParseAddrPort(token)
+	if err != nil {
+		return netip.AddrPort{}, 0
+	}
+
+	return v, len(token)
+}
+
+// Reports whether the token at the beginning of `in` looks like an attempt
+// at a network address, and if so, why it isn't a valid one. Returns the
+// token and a nil error otherwise.
+func checkAddr(in string) (string, error) {
+	token := addrToken(in)
+
+	// times of day and floats share some of an address' characters, so
+	// only tokens with more of them are considered
+	looksLike := strings.HasPrefix(token, "[") || strings.Contains(token, "::") ||
+		strings.Count(token, ".") == 3 || strings.Count(token, ":") > 2
+	if !looksLike {
+		return token, nil
+	}
+
+	var err error
+	switch {
+	case strings.Contains(token, "/"):
+		_, err = netip.ParsePrefix(token)
+	case strings.HasPrefix(token, "[") || strings.Count(token, ":") == 1:
+		_, err = netip.ParseAddrPort(token)
+	default:
+		_, err = netip.ParseAddr(token)
+	}
+
+	return token, err
+}
+
+// Attempts to extract an absolute URL, e.g. "https://example.com/", from the
+// beginning of `in`. The URL must have a scheme followed by "//", and ends
+// at the first whitespace. Trailing commas and braces are left out, so URLs
+// can be used in inline maps.
+func readURL(in string) (*url.URL, int) {
+	if !reURL.MatchString(in) {
+		return nil, 0
+	}
+
+	n := 0
+	for n < len(in) && !strings.ContainsRune(Space, rune(in[n])) {
+		n++
+	}
+	for n > 0 && (in[n-1] == ',' || in[n-1] == '}') {
+		n--
+	}
+
+	v, err := url.Parse(in[:n])
+	if err != nil {
+		return nil, 0
+	}
+
+	return v, n
+}
+
+// Attempts to extract a secret reference, e.g. `secret("db/password")`, from
+// the beginning of `in`. The secret's value is resolved later, once the whole
+// configuration has been read.
+func readSecret(in string) (Secret, int) {
+	rest, ok := strings.CutPrefix(in, "secret(")
+	if !ok {
+		return Secret{}, 0
+	}
+
+	name, n := readString(rest)
+	if n == 0 || name == "" || !strings.HasPrefix(rest[n:], ")") {
+		return Secret{}, 0
+	}
+
+	return Secret{name: name}, len(in) - len(rest) + n + 1
+}
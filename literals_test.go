@@ -1,6 +1,10 @@
 package walnut
 
 import (
+	"fmt"
+	"math"
+	"net/netip"
+	"strings"
 	"testing"
 	"time"
 )
@@ -20,12 +24,32 @@ func TestReadBool(t *testing.T) {
 		got, n := readBool(test.in)
 		if got != test.want || n != test.n {
 			t.Errorf("readBool(%q):", test.in)
-			t.Errorf("   got %v, %n", got, n)
+			t.Errorf("   got %v, %v", got, n)
 			t.Errorf("  want %v, %v", test.want, test.n)
 		}
 	}
 }
 
+var readNullTests = []struct {
+	in string
+	n  int
+}{
+	{"null", 4},
+	{"nullify", 4},
+	{"Null", 0},
+	{"nil", 0},
+}
+
+func TestReadNull(t *testing.T) {
+	for _, test := range readNullTests {
+		if _, n := readNull(test.in); n != test.n {
+			t.Errorf("readNull(%q):", test.in)
+			t.Errorf("   got %v", n)
+			t.Errorf("  want %v", test.n)
+		}
+	}
+}
+
 var readInt64Tests = []struct {
 	in   string
 	want int64
@@ -33,8 +57,8 @@ var readInt64Tests = []struct {
 }{
 	{"", 0, 0},
 	{"0", 0, 1},
-	{"00000000", 0, 8},
-	{"00000001", 1, 8},
+	{"00000000", 0, 0},
+	{"00000001", 0, 0},
 	{"12345", 12345, 5},
 	{"1 2 3", 1, 1},
 	{"-10", -10, 3},
@@ -42,10 +66,32 @@ var readInt64Tests = []struct {
 	{"-10 -10", -10, 3},
 	{"--2", 0, 0},
 	{"+-3128", 0, 0},
-	{"-012301 ", -12301, 7},
-	{"-012301", -12301, 7},
+	{"-012301 ", 0, 0},
+	{"-012301", 0, 0},
+	{"+12301", 12301, 6},
 	{"103.0", 103, 3},
-	{"0x31", 0, 1},
+	{"0x31", 49, 4},
+	{"0xff", 255, 4},
+	{"0xFF_FF", 65535, 7},
+	{"-0x10", -16, 5},
+	{"0x", 0, 0},
+	{"0xg", 0, 0},
+	{"0X31", 0, 1},
+	{"0o755", 493, 5},
+	{"0o8", 0, 0},
+	{"0o", 0, 0},
+	{"0b1010", 10, 6},
+	{"0b102", 0, 0},
+	{"1_000_000", 1000000, 9},
+	{"1_000_000ms", 1000000, 9},
+	{"1__000", 0, 0},
+	{"1000_", 0, 0},
+	{"_1000", 0, 0},
+	{"0x_ff", 0, 0},
+	{"0x7fffffffffffffff", 1<<63 - 1, 18},
+	{"0x8000000000000000", 0, 0},
+	{"-0x8000000000000000", -1 << 63, 19},
+	{"0b" + strings.Repeat("1", 64), 0, 0},
 	{"9223372036854775807", 1<<63 - 1, 19},
 	{"9223372036854775808", 0, 0},
 	{"9223372036854775809", 0, 0},
@@ -59,12 +105,42 @@ func TestReadInt64(t *testing.T) {
 		got, n := readInt64(test.in)
 		if got != test.want || n != test.n {
 			t.Errorf("readInt64(%q):", test.in)
-			t.Errorf("   got %v, %n", got, n)
+			t.Errorf("   got %v, %v", got, n)
 			t.Errorf("  want %v, %v", test.want, test.n)
 		}
 	}
 }
 
+var scanInt64Tests = []struct {
+	in  string
+	n   int
+	err error
+}{
+	{"", 0, nil},
+	{"abc", 0, nil},
+	{"12", 2, nil},
+	{"0x", 2, fmt.Errorf(`missing digits after "0x"`)},
+	{"0b 1", 2, fmt.Errorf(`missing digits after "0b"`)},
+	{"1__0", 4, fmt.Errorf("underscores must separate digits")},
+	{"1_", 2, fmt.Errorf("underscores must separate digits")},
+	{"0755", 4, fmt.Errorf("leading zeros are ambiguous, use 0o for octal")},
+	{"-00", 3, fmt.Errorf("leading zeros are ambiguous, use 0o for octal")},
+	{"0o78", 4, fmt.Errorf("invalid digit '8' in octal literal")},
+	{"0b12", 4, fmt.Errorf("invalid digit '2' in binary literal")},
+	{"9223372036854775808", 19, fmt.Errorf("9223372036854775808 is out of range")},
+}
+
+func TestScanInt64(t *testing.T) {
+	for _, test := range scanInt64Tests {
+		_, n, err := scanInt64(test.in)
+		if n != test.n || !eq(err, test.err) {
+			t.Errorf("scanInt64(%q):", test.in)
+			t.Errorf("   got %v, %v", n, err)
+			t.Errorf("  want %v, %v", test.n, test.err)
+		}
+	}
+}
+
 var readFloat64Tests = []struct {
 	in   string
 	want float64
@@ -101,14 +177,44 @@ var readFloat64Tests = []struct {
 	{"-100000000000000008388608.0", -1.0000000000000001e+23, 27},
 	{"-100000000000000016777215.0", -1.0000000000000001e+23, 27},
 	{"-100000000000000016777216.0", -1.0000000000000003e+23, 27},
+	{"1e-6", 1e-6, 4},
+	{"1E6", 1e6, 3},
+	{"6.02e23", 6.02e23, 7},
+	{"6.02e+23", 6.02e23, 8},
+	{"-2.5e-3", -2.5e-3, 7},
+	{"1e", 0, 0},
+	{"1e+", 0, 0},
+	{"1.e5", 0, 0},
+	{".5e5", 0, 0},
+	{"1e5.0", 1e5, 3},
+	{"1e 5", 0, 0},
+	{"0.1e1", 1, 5},
+	{"1e23", 1e23, 4},
+	{"1e-400", 0, 6},
+	{"4.9e-324", 5e-324, 8},
+	{"2.2250738585072014e-308", 2.2250738585072014e-308, 23},
+	{"1.7976931348623157e308", 1.7976931348623157e308, 22},
+	{"1.7976931348623159e308", 0, 0},
+	{"1e309", 0, 0},
+	{"-1e309", 0, 0},
+	{"0.30000000000000004", 0.30000000000000004, 19},
+	{"9007199254740993.0", 9007199254740992, 18},
+	{"inf", math.Inf(1), 3},
+	{"+inf", math.Inf(1), 4},
+	{"-inf", math.Inf(-1), 4},
+	{"nan", math.NaN(), 3},
+	{"-nan", 0, 0},
+	{"Inf", 0, 0},
+	{"infinity", math.Inf(1), 3},
 }
 
 func TestReadFloat64(t *testing.T) {
 	for _, test := range readFloat64Tests {
 		got, n := readFloat64(test.in)
-		if got != test.want || n != test.n {
+		same := got == test.want || math.IsNaN(got) && math.IsNaN(test.want)
+		if !same || n != test.n {
 			t.Errorf("readFloat64(%q):", test.in)
-			t.Errorf("   got %v, %n", got, n)
+			t.Errorf("   got %v, %v", got, n)
 			t.Errorf("  want %v, %v", test.want, test.n)
 		}
 	}
@@ -147,7 +253,7 @@ func TestReadString(t *testing.T) {
 		got, n := readString(test.in)
 		if got != test.want || n != test.n {
 			t.Errorf("readString(%q):", test.in)
-			t.Errorf("   got %q, %n", got, n)
+			t.Errorf("   got %q, %v", got, n)
 			t.Errorf("  want %q, %v", test.want, test.n)
 		}
 	}
@@ -185,11 +291,32 @@ var readDurationTests = []struct {
 	{"1w 1d\t24h 1440m", 10 * 24 * time.Hour, 15},
 	{"10w -3d", 10 * 7 * 24 * time.Hour, 3},
 	{"1d 200", 24 * time.Hour, 2},
-	{"1h 1m 1.3s", 1*time.Hour + 1*time.Minute, 5},
-	{"-3h", 0, 0},
-	{"+5m", 0, 0},
-	{"300.5h", 0, 0},
-	{"1.2d20m", 0, 0},
+	{"1h 1m 1.3s", time.Hour + time.Minute + 1300*time.Millisecond, 10},
+	{"-3h", -3 * time.Hour, 3},
+	{"+5m", 5 * time.Minute, 3},
+	{"-1h 30m", -90 * time.Minute, 7},
+	{"- 3h", 0, 0},
+	{"--3h", 0, 0},
+	{"+-3h", 0, 0},
+	{"-", 0, 0},
+	{"-0s", 0, 3},
+	{"1h -30m", time.Hour, 2},
+	{"300.5h", 300*time.Hour + 30*time.Minute, 6},
+	{"1.2d20m", 28*time.Hour + 68*time.Minute, 7},
+	{"1.5s", 1500 * time.Millisecond, 4},
+	{"-1.5s", -1500 * time.Millisecond, 5},
+	{"0.5us", 500 * time.Nanosecond, 5},
+	{"0.5ns", 0, 5},
+	{"1.0000000001s", time.Second, 13},
+	{"0.333333333333s", 333333333 * time.Nanosecond, 15},
+	{"-0.333333333333s", -333333333 * time.Nanosecond, 16},
+	{"1.5h 1.5m", 91*time.Minute + 30*time.Second, 9},
+	{"1.5m 90s", 3 * time.Minute, 8},
+	{"1.5m 1.5m", 0, 0},
+	{".5s", 0, 0},
+	{"5.s", 0, 0},
+	{"1..5s", 0, 0},
+	{"1.5.5s", 0, 0},
 	{"1s2h", 0, 0},
 	{"1200ms 3s", 0, 0},
 	{"4h 5d 6w 7m", 0, 0},
@@ -203,44 +330,361 @@ var readDurationTests = []struct {
 	{"9223372037s", 0, 0},
 	{"9223372036s 854775807ns", 9223372036854775807 * time.Nanosecond, 23},
 	{"9223372036s 854775808ns", 0, 0},
+	{"9223372036.854775807s", 9223372036854775807 * time.Nanosecond, 21},
+	{"9223372036.854775808s", 0, 0},
+	{"-9223372036854775808ns", -1 << 63, 22},
+	{"-9223372036s 854775808ns", -1 << 63, 24},
+	{"-9223372036s 854775809ns", 0, 0},
+	{"15250.28445w", 9223372035360000000 * time.Nanosecond, 12},
+	{"15250.2845w", 0, 0},
 }
 
 func TestReadDurationTests(t *testing.T) {
 	for _, test := range readDurationTests {
 		got, n := readDuration(test.in)
 		if got != test.want || n != test.n {
-			t.Errorf("readTime(%q):", test.in)
-			t.Errorf("   got %s, %n", got, n)
+			t.Errorf("readDuration(%q):", test.in)
+			t.Errorf("   got %s, %v", got, n)
 			t.Errorf("  want %s, %v", test.want, test.n)
 		}
 	}
 }
 
+var berlin, _ = time.LoadLocation("Europe/Berlin")
+
 var readTimeTests = []struct {
-	in string
-	n  int
+	in   string
+	want time.Time
+	n    int
 }{
-	{"", 0},
-	{"1970-01-01 00:00:00 +0000", 25},
-	{"2001-02-03 04:05:06 +0000", 25},
-	{"1997-08-28 15:30:27.123 +0000", 29},
-	{"1997-08-28 14:07:27 -0123", 25},
-	{"01:02:03", 0},
-	{"1970-01-01", 0},
-	{"1970-01-01 00:00:00", 0},
-	{"1970-02-48 00:00:00 +0000", 0},
-	{"70-01-01 00:00:00", 0},
-	{"1970-01-01 00:00:00 UTC", 0},
+	{"", time.Time{}, 0},
+	{"1970-01-01 00:00:00 +0000", time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC), 25},
+	{"2001-02-03 04:05:06 +0000", time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC), 25},
+	{"1997-08-28 15:30:27.123 +0000", time.Date(1997, 8, 28, 15, 30, 27, 123e6, time.UTC), 29},
+	{"1997-08-28 14:07:27 -0123", time.Date(1997, 8, 28, 15, 30, 27, 0, time.UTC), 25},
+	{"01:02:03", time.Time{}, 0},
+	{"1970-01-01", time.Time{}, 0},
+	{"1970-01-01 00:00:00", time.Time{}, 0},
+	{"1970-02-48 00:00:00 +0000", time.Time{}, 0},
+	{"70-01-01 00:00:00", time.Time{}, 0},
+	{"1970-01-01 00:00:00 UTC", time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC), 23},
+	{"2013-02-25 17:07:46 Europe/Berlin", time.Date(2013, 2, 25, 17, 7, 46, 0, berlin), 33},
+	{"2013-07-25 17:07:46.5 Europe/Berlin # summer", time.Date(2013, 7, 25, 17, 7, 46, 5e8, berlin), 35},
+	{"2013-02-25 17:07:46 America/Argentina/Buenos_Aires", time.Date(2013, 2, 25, 20, 7, 46, 0, time.UTC), 50},
+	{"2013-02-25 17:07:46 Etc/GMT+1", time.Date(2013, 2, 25, 18, 7, 46, 0, time.UTC), 29},
+	{"2013-02-25 17:07:46 Europe/Nowhere", time.Time{}, 0},
+	{"2013-02-25 17:07:46 Local", time.Time{}, 0},
+	{"1979-05-27T07:32:00Z", time.Date(1979, 5, 27, 7, 32, 0, 0, time.UTC), 20},
+	{"1979-05-27T00:32:00.999999-07:00", time.Date(1979, 5, 27, 7, 32, 0, 999999e3, time.UTC), 32},
+	{"1979-05-27T07:32:00", time.Time{}, 0},
+	{"1979-05-27T07:32:00+0700", time.Time{}, 0},
+	{"1979-05-27t07:32:00z", time.Time{}, 0},
+	{"1979-13-27T07:32:00Z", time.Time{}, 0},
 }
 
 func TestReadTime(t *testing.T) {
 	for _, test := range readTimeTests {
 		got, n := readTime(test.in)
-		want, _ := time.Parse("2006-01-02 15:04:05 -0700", test.in[:n])
-		if !want.Equal(got) || n != test.n {
+		if !got.Equal(test.want) || n != test.n {
 			t.Errorf("readTime(%q):", test.in)
-			t.Errorf("   got %s, %n", got, n)
-			t.Errorf("  want %s, %v", want, test.n)
+			t.Errorf("   got %s, %v", got, n)
+			t.Errorf("  want %s, %v", test.want, test.n)
+		}
+	}
+}
+
+var readDateTests = []struct {
+	in   string
+	want Date
+	n    int
+}{
+	{"", Date{}, 0},
+	{"2013-02-25", Date{2013, time.February, 25}, 10},
+	{"2012-02-29", Date{2012, time.February, 29}, 10},
+	{"2013-02-29", Date{}, 0},
+	{"2013-13-01", Date{}, 0},
+	{"2013-2-25", Date{}, 0},
+	{"2013-02-25 17:07:46", Date{2013, time.February, 25}, 10},
+	{"20130225", Date{}, 0},
+}
+
+func TestReadDate(t *testing.T) {
+	for _, test := range readDateTests {
+		got, n := readDate(test.in)
+		if got != test.want || n != test.n {
+			t.Errorf("readDate(%q):", test.in)
+			t.Errorf("   got %v, %v", got, n)
+			t.Errorf("  want %v, %v", test.want, test.n)
+		}
+	}
+}
+
+var readTimeOfDayTests = []struct {
+	in   string
+	want TimeOfDay
+	n    int
+}{
+	{"", TimeOfDay{}, 0},
+	{"22:30", TimeOfDay{22, 30, 0, 0}, 5},
+	{"06:15:30", TimeOfDay{6, 15, 30, 0}, 8},
+	{"06:15:30.5", TimeOfDay{6, 15, 30, 5e8}, 10},
+	{"06:15:30.123456789", TimeOfDay{6, 15, 30, 123456789}, 18},
+	{"00:00", TimeOfDay{}, 5},
+	{"23:59:59", TimeOfDay{23, 59, 59, 0}, 8},
+	{"24:00", TimeOfDay{}, 0},
+	{"12:60", TimeOfDay{}, 0},
+	{"12:00:60", TimeOfDay{}, 0},
+	{"6:15", TimeOfDay{}, 0},
+	{"06:15:3", TimeOfDay{6, 15, 0, 0}, 5},
+}
+
+func TestReadTimeOfDay(t *testing.T) {
+	for _, test := range readTimeOfDayTests {
+		got, n := readTimeOfDay(test.in)
+		if got != test.want || n != test.n {
+			t.Errorf("readTimeOfDay(%q):", test.in)
+			t.Errorf("   got %v, %v", got, n)
+			t.Errorf("  want %v, %v", test.want, test.n)
+		}
+	}
+}
+
+var readBytesTests = []struct {
+	in   string
+	want ByteSize
+	n    int
+}{
+	{"", 0, 0},
+	{"B", 0, 0},
+	{"0B", 0, 2},
+	{"512B", 512, 4},
+	{"64KB", 64000, 4},
+	{"64KiB", 65536, 5},
+	{"1.5KiB", 1536, 6},
+	{"1.5GB", 1500000000, 5},
+	{"2TiB", 2 << 40, 4},
+	{"1.5B", 0, 0},
+	{"1.0001KB", 0, 0},
+	{"100", 0, 0},
+	{"-1KB", 0, 0},
+	{"1 KB", 0, 0},
+	{"1kB", 0, 0},
+	{"7EiB", 7 << 60, 4},
+	{"8EiB", 0, 0},
+	{"9223372036854775807B", 9223372036854775807, 20},
+	{"9223372036854775808B", 0, 0},
+}
+
+func TestReadBytes(t *testing.T) {
+	for _, test := range readBytesTests {
+		got, n := readBytes(test.in)
+		if got != test.want || n != test.n {
+			t.Errorf("readBytes(%q):", test.in)
+			t.Errorf("   got %v, %v", got, n)
+			t.Errorf("  want %v, %v", test.want, test.n)
+		}
+	}
+}
+
+var readPeriodTests = []struct {
+	in   string
+	want Period
+	n    int
+}{
+	{"", Period{}, 0},
+	{"1y", Period{1, 0, 0}, 2},
+	{"3mo", Period{0, 3, 0}, 3},
+	{"2y 3mo", Period{2, 3, 0}, 6},
+	{"1y6mo2w3d", Period{1, 6, 17}, 9},
+	{"1mo 15d", Period{0, 1, 15}, 7},
+	{"0mo", Period{}, 3},
+	{"-1y 6mo", Period{-1, -6, 0}, 7},
+	{"+1y", Period{1, 0, 0}, 3},
+	{"- 1y", Period{}, 0},
+	{"3mo 2y", Period{0, 3, 0}, 3},
+	{"1y 1y", Period{1, 0, 0}, 2},
+	{"3d", Period{}, 0},
+	{"2w 3d", Period{}, 0},
+	{"3m", Period{}, 0},
+	{"1.5y", Period{}, 0},
+	{"1y 6mo 2h", Period{1, 6, 0}, 6},
+	{"2147483647y", Period{2147483647, 0, 0}, 11},
+	{"2147483648y", Period{}, 0},
+	{"P1Y2M10D", Period{1, 2, 10}, 8},
+	{"P2W", Period{0, 0, 14}, 3},
+	{"P3D", Period{0, 0, 3}, 3},
+	{"-P1M", Period{0, -1, 0}, 4},
+	{"P", Period{}, 0},
+	{"P1D2M", Period{0, 0, 1}, 3},
+	{"P1DT2H", Period{0, 0, 1}, 3},
+	{"p1d", Period{}, 0},
+}
+
+func TestReadPeriod(t *testing.T) {
+	for _, test := range readPeriodTests {
+		got, n := readPeriod(test.in)
+		if got != test.want || n != test.n {
+			t.Errorf("readPeriod(%q):", test.in)
+			t.Errorf("   got %v, %v", got, n)
+			t.Errorf("  want %v, %v", test.want, test.n)
+		}
+	}
+}
+
+var periodAddToTests = []struct {
+	in   Period
+	t    time.Time
+	want time.Time
+}{
+	{Period{0, 1, 0}, time.Date(2013, 1, 15, 12, 0, 0, 0, time.UTC), time.Date(2013, 2, 15, 12, 0, 0, 0, time.UTC)},
+	{Period{1, 0, 0}, time.Date(2012, 2, 29, 0, 0, 0, 0, time.UTC), time.Date(2013, 3, 1, 0, 0, 0, 0, time.UTC)},
+	{Period{0, -3, -1}, time.Date(2013, 5, 1, 0, 0, 0, 0, time.UTC), time.Date(2013, 1, 31, 0, 0, 0, 0, time.UTC)},
+}
+
+func TestPeriodAddTo(t *testing.T) {
+	for _, test := range periodAddToTests {
+		if got := test.in.AddTo(test.t); !got.Equal(test.want) {
+			t.Errorf("%v.AddTo(%v):", test.in, test.t)
+			t.Errorf("   got %v", got)
+			t.Errorf("  want %v", test.want)
+		}
+	}
+}
+
+var readAddrTests = []struct {
+	in   string
+	want netip.Addr
+	n    int
+}{
+	{"", netip.Addr{}, 0},
+	{"10.0.0.1", netip.MustParseAddr("10.0.0.1"), 8},
+	{"10.0.0.1 # gateway", netip.MustParseAddr("10.0.0.1"), 8},
+	{"10.0.0.1, b = 2}", netip.MustParseAddr("10.0.0.1"), 8},
+	{"::1", netip.MustParseAddr("::1"), 3},
+	{"fe80::1%eth0", netip.MustParseAddr("fe80::1%eth0"), 12},
+	{"10.0.0.256", netip.Addr{}, 0},
+	{"10.0.0", netip.Addr{}, 0},
+	{"10.0.0.1/8", netip.Addr{}, 0},
+	{"10.0.0.1:80", netip.Addr{}, 0},
+	{"15:04", netip.Addr{}, 0},
+}
+
+func TestReadAddr(t *testing.T) {
+	for _, test := range readAddrTests {
+		got, n := readAddr(test.in)
+		if got != test.want || n != test.n {
+			t.Errorf("readAddr(%q):", test.in)
+			t.Errorf("   got %v, %v", got, n)
+			t.Errorf("  want %v, %v", test.want, test.n)
+		}
+	}
+}
+
+var readPrefixTests = []struct {
+	in   string
+	want netip.Prefix
+	n    int
+}{
+	{"", netip.Prefix{}, 0},
+	{"10.0.0.0/8", netip.MustParsePrefix("10.0.0.0/8"), 10},
+	{"10.1.2.3/8", netip.MustParsePrefix("10.1.2.3/8"), 10},
+	{"fd00::/8 # ula", netip.MustParsePrefix("fd00::/8"), 8},
+	{"10.0.0.0/33", netip.Prefix{}, 0},
+	{"10.0.0.0", netip.Prefix{}, 0},
+}
+
+func TestReadPrefix(t *testing.T) {
+	for _, test := range readPrefixTests {
+		got, n := readPrefix(test.in)
+		if got != test.want || n != test.n {
+			t.Errorf("readPrefix(%q):", test.in)
+			t.Errorf("   got %v, %v", got, n)
+			t.Errorf("  want %v, %v", test.want, test.n)
+		}
+	}
+}
+
+var readAddrPortTests = []struct {
+	in   string
+	want netip.AddrPort
+	n    int
+}{
+	{"", netip.AddrPort{}, 0},
+	{"10.0.0.1:80", netip.MustParseAddrPort("10.0.0.1:80"), 11},
+	{"[::1]:8080 # local", netip.MustParseAddrPort("[::1]:8080"), 10},
+	{"10.0.0.1:65536", netip.AddrPort{}, 0},
+	{"10.0.0.1", netip.AddrPort{}, 0},
+	{"::1:80", netip.AddrPort{}, 0},
+}
+
+func TestReadAddrPort(t *testing.T) {
+	for _, test := range readAddrPortTests {
+		got, n := readAddrPort(test.in)
+		if got != test.want || n != test.n {
+			t.Errorf("readAddrPort(%q):", test.in)
+			t.Errorf("   got %v, %v", got, n)
+			t.Errorf("  want %v, %v", test.want, test.n)
+		}
+	}
+}
+
+var readURLTests = []struct {
+	in   string
+	want string
+	n    int
+}{
+	{"", "", 0},
+	{"https://example.com/", "https://example.com/", 20},
+	{"https://example.com/a?b=c#d", "https://example.com/a?b=c#d", 27},
+	{"https://example.com/ # home", "https://example.com/", 20},
+	{"postgres://user@db:5432/app}", "postgres://user@db:5432/app", 27},
+	{"http://[::1]:80/, b = 1}", "http://[::1]:80/", 16},
+	{"example.com/", "", 0},
+	{"mailto:user@example.com", "", 0},
+	{"1http://example.com", "", 0},
+	{"http://%zz", "", 0},
+}
+
+func TestReadURL(t *testing.T) {
+	for _, test := range readURLTests {
+		got, n := readURL(test.in)
+
+		s := ""
+		if got != nil {
+			s = got.String()
+		}
+
+		if s != test.want || n != test.n {
+			t.Errorf("readURL(%q):", test.in)
+			t.Errorf("   got %v, %v", s, n)
+			t.Errorf("  want %v, %v", test.want, test.n)
+		}
+	}
+}
+
+var readSecretTests = []struct {
+	in   string
+	want Secret
+	n    int
+}{
+	{"", Secret{}, 0},
+	{`secret("db/password")`, Secret{name: "db/password"}, 21},
+	{`secret("a") # comment`, Secret{name: "a"}, 11},
+	{`secret("a"), b = 1}`, Secret{name: "a"}, 11},
+	{`secret("")`, Secret{}, 0},
+	{`secret(a)`, Secret{}, 0},
+	{`secret("a"`, Secret{}, 0},
+	{`secret ("a")`, Secret{}, 0},
+	{`"secret"`, Secret{}, 0},
+}
+
+func TestReadSecret(t *testing.T) {
+	for _, test := range readSecretTests {
+		got, n := readSecret(test.in)
+		if got != test.want || n != test.n {
+			t.Errorf("readSecret(%q):", test.in)
+			t.Errorf("   got %#v, %v", got, n)
+			t.Errorf("  want %#v, %v", test.want, test.n)
 		}
 	}
 }
@@ -0,0 +1,49 @@
+package walnut
+
+// Merges several Configs into one, with later Configs taking precedence over
+// earlier ones. A key defined in a later Config replaces every conflicting
+// key in the Configs before it, so "http.port = 80" replaces a "http" value,
+// and "http = 1" replaces the whole "http" group.
+//
+// Keys set to null don't appear in the result; they only mask the keys
+// they conflict with. "http = null" removes "http" as well as every key in
+// the "http" group.
+//
+// Each key keeps the position and documentation it had in the Config which
+// defined it.
+func Merge(configs ...Config) Config {
+	data := make(map[string]interface{})
+	positions := make(map[string]Position)
+	docs := make(map[string]string)
+
+	for _, conf := range configs {
+		keys := conf.Keys()
+
+		// keys within a single Config never conflict, so everything this
+		// Config overrides can be removed before any of its keys are added
+		for _, key := range keys {
+			for prev, _ := range data {
+				if conflicts(key, prev) || conflicts(prev, key) {
+					delete(data, prev)
+					delete(positions, prev)
+					delete(docs, prev)
+				}
+			}
+		}
+
+		for _, key := range keys {
+			v, _ := conf.Get(key)
+			if _, ok := v.(Null); ok {
+				continue
+			}
+
+			data[key] = v
+			if p, ok := conf.Position(key); ok {
+				positions[key] = p
+			}
+			copyDocs(docs, conf, key)
+		}
+	}
+
+	return &config{data: data, positions: positions, docs: docs}
+}
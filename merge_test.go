@@ -0,0 +1,72 @@
+package walnut
+
+import (
+	"testing"
+)
+
+var mergeTests = []struct {
+	in   []string
+	want map[string]interface{}
+}{
+	{nil, map[string]interface{}{}},
+	{[]string{"a = 1"}, map[string]interface{}{"a": int64(1)}},
+	{[]string{"a = 1", "b = 2"}, map[string]interface{}{"a": int64(1), "b": int64(2)}},
+	{[]string{"a = 1", "a = 2"}, map[string]interface{}{"a": int64(2)}},
+	{[]string{"a = 1", "a = null"}, map[string]interface{}{}},
+	{[]string{"a = null", "a = 1"}, map[string]interface{}{"a": int64(1)}},
+	{[]string{"a = null"}, map[string]interface{}{}},
+	{
+		[]string{"a.b = 1\na.c = 2\nab = 3", "a = null"},
+		map[string]interface{}{"ab": int64(3)},
+	},
+	{
+		[]string{"a.b = 1\na.c = 2", "a.b = null"},
+		map[string]interface{}{"a.c": int64(2)},
+	},
+	{
+		[]string{"a.b = 1", "a = 2"},
+		map[string]interface{}{"a": int64(2)},
+	},
+	{
+		[]string{"a = 1", "a.b = 2"},
+		map[string]interface{}{"a.b": int64(2)},
+	},
+	{
+		[]string{"a = 1\nb = 1", "a = null", "b = null\nc = 3"},
+		map[string]interface{}{"c": int64(3)},
+	},
+}
+
+func TestMerge(t *testing.T) {
+	for _, test := range mergeTests {
+		configs := make([]Config, len(test.in))
+		for i, in := range test.in {
+			conf, err := Read([]byte(in))
+			if err != nil {
+				t.Fatalf("Read(%q): %v", in, err)
+			}
+			configs[i] = conf
+		}
+
+		got := Merge(configs...).(*config).data
+		if !eq(got, test.want) {
+			t.Errorf("Merge(%q):", test.in)
+			t.Errorf("   got %v", got)
+			t.Errorf("  want %v", test.want)
+		}
+	}
+}
+
+func TestMergePosition(t *testing.T) {
+	base, _ := Read([]byte("a = 1\nb = 2"))
+	override, _ := Read([]byte("\n\nb = 3"))
+
+	conf := Merge(base, override)
+
+	if p, _ := conf.Position("a"); p.Line != 1 {
+		t.Errorf("Merge(...).Position(\"a\"): got line %d, want 1", p.Line)
+	}
+	if p, _ := conf.Position("b"); p.Line != 3 {
+		t.Errorf("Merge(...).Position(\"b\"): got line %d, want 3", p.Line)
+	}
+}
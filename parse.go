@@ -4,63 +4,132 @@ import (
 	"fmt"
 	"io/ioutil"
 	"strings"
+	"unicode"
 )
 
 // String consisting of all characters to be treated as whitespace.
 const Space = " \t\r\n\v\f\u0085\u00a0"
 
 // Parses a configuration file. Panics if reading the file fails, or if
-// it contains any syntax errors.
+// it contains any syntax errors. Files using conditional blocks, overrides
+// or secret references need LoadWith instead.
 func Load(path string) Config {
-	in, err := ioutil.ReadFile(path)
+	conf, _, err := LoadWith(path, nil)
 	if err != nil {
 		panic(err)
 	}
 
-	conf, err := Read(in)
+	return conf
+}
+
+// Like Load, but with options, and returning an error rather than panicking.
+// Also returns a list of warnings, as ReadWith does. Positions record path
+// as their file.
+func LoadWith(path string, opts *ReadOptions) (Config, []Warning, error) {
+	in, err := ioutil.ReadFile(path)
 	if err != nil {
-		panic(err)
+		return nil, nil, err
 	}
 
-	return conf
+	return read(in, path, opts)
 }
 
 // Generates a Config instance from a raw configuration file. Returns an
 // error if the source contains a syntax error.
 func Read(in []byte) (Config, error) {
+	conf, _, err := read(in, "", nil)
+	return conf, err
+}
+
+// Options controlling how a configuration file is read.
+type ReadOptions struct {
+	// Override lets a later assignment to a value key replace an earlier
+	// one, rather than causing an error; useful for local override files
+	// appended to a base configuration. Keys which collide in shape, like
+	// "foo.bar" and "foo.bar.baz", are still rejected.
+	Override bool
+
+	// Vars holds the variables tested by conditional blocks, e.g. "env"
+	// for `@if env == "prod"`.
+	Vars map[string]string
+
+	// Secrets resolves secret references, e.g. `secret("db/password")`.
+	// Reading a configuration containing any fails without one.
+	Secrets SecretProvider
+}
+
+// Like Read, but with options. Also returns a list of warnings, one for each
+// value key overridden when opts.Override is set. A nil opts is the same as
+// the zero ReadOptions.
+func ReadWith(in []byte, opts *ReadOptions) (Config, []Warning, error) {
+	return read(in, "", opts)
+}
+
+// Like ReadWith, but records the name of the file the source was read from
+// in each key's Position.
+func read(in []byte, file string, opts *ReadOptions) (Config, []Warning, error) {
+	if opts == nil {
+		opts = &ReadOptions{}
+	}
+
 	// generate a slice of lines from the input, while parsing
 	// indentation and discarding empty lines
 	lines, err := split(in)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	// reduce the lines to a set of assignments
-	assignments, err := interpret(lines)
+	// evaluate conditional blocks, keeping only the selected lines
+	lines, err = selectBranches(lines, opts.Vars)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+
+	// reduce the lines to a set of assignments, keeping the comments
+	// documenting each key and the number of elements of each repeated
+	// key group
+	assignments, docs, sections, err := interpret(lines, leadingComments(in))
+	if err != nil {
+		return nil, nil, err
 	}
 
 	// generate the key lookup map, while checking for name conflicts
-	table, err := initialize(assignments)
+	table, warnings, err := initialize(assignments, opts.Override)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+
+	// remember where each key was defined
+	positions := make(map[string]Position, len(assignments))
+	for _, a := range assignments {
+		positions[a.key] = Position{file, a.line, a.column, a.literal}
 	}
 
-	return &config{"", table}, nil
+	// look up the values of any secrets
+	if err := resolveSecrets(table, positions, opts.Secrets); err != nil {
+		return nil, nil, err
+	}
+
+	return &config{data: table, positions: positions, docs: docs, sections: sections}, warnings, nil
 }
 
 const (
 	errIndent   = "illegal indentation on line %d"
 	errKey      = "illegal key on line %d"
 	errValue    = "illegal value on line %d: %q"
+	errInt      = "illegal integer on line %d: %q (%v)"
+	errAddr     = "illegal address on line %d: %q (%v)"
 	errConflict = "key %q (line %d) collides with %q (line %d)"
+	errRepeated = "key %q (line %d) collides with the repeated key group %q"
+
+	warnOverride = "overrides the value from line %d"
 )
 
 type line struct {
 	index   int
 	depth   int
 	content string
+	indent  int
 }
 
 // Splits a raw input file into lines, discarding all empty lines in the
@@ -79,38 +148,50 @@ func split(in []byte) ([]line, error) {
 		}
 
 		indent, content := selectSpace(content)
-		level := len(indents)
 
 		// lines should be 1-indexed
 		index++
 
 		// measure the line's indentation depth
-		switch {
-		case indent == "":
-			level = 0
-		case len(indents) == 0:
+		level, ok := indentLevel(indents, indent)
+		if !ok {
 			return nil, fmt.Errorf(errIndent, index)
-		default:
-			for i, prev := range indents {
-				if !strings.HasPrefix(indent, prev) {
-					return nil, fmt.Errorf(errIndent, index)
-				}
-				if len(indent) == len(prev) {
-					level = i
-					break
-				}
-			}
 		}
 
 		indents = append(indents[:level], indent)
-		lines = append(lines, line{index, level, content})
+		lines = append(lines, line{index, level, content, len(indent)})
 	}
 
 	return lines, nil
 }
 
+// Determines the depth of a line given its indentation, and the indentation
+// of each of the current line's ancestors. A line must either line up with
+// one of its ancestors, or extend the innermost one. Returns false if it
+// does neither.
+func indentLevel(indents []string, indent string) (int, bool) {
+	switch {
+	case indent == "":
+		return 0, true
+	case len(indents) == 0:
+		return 0, false
+	}
+
+	for i, prev := range indents {
+		if !strings.HasPrefix(indent, prev) {
+			return 0, false
+		}
+		if len(indent) == len(prev) {
+			return i, true
+		}
+	}
+
+	return len(indents), true
+}
+
 type assignment struct {
 	line    int
+	column  int
 	key     string
 	literal string
 	value   interface{}
@@ -119,44 +200,95 @@ type assignment struct {
 // Transforms a set of lines to a set of key assignments. Resolves key
 // hierarchy and parses values, among other things. Returns a non-nil
 // error if any line contains an illegal keys or value.
-func interpret(lines []line) ([]assignment, error) {
+//
+// Also returns the documentation of each key and key group: the comments
+// directly above its line, as collected by leadingComments, followed by the
+// line's trailing comment.
+//
+// The elements of repeated key groups are counted as well, even ones
+// without any keys. Returns an error if a key collides with a repeated
+// group, as in "upstream = 1" next to "upstream[]".
+func interpret(lines []line, comments map[int]string) ([]assignment, map[string]string, sectionCounter, error) {
 	output := make([]assignment, 0)
+	docs := make(map[string]string)
 	groups := make([]string, 0)
+	sections := make(sectionCounter)
 
 	for _, line := range lines {
 		key, rest := selectKey(line.content)
+
+		key, repeated, ok := sections.lineKey(groups[:line.depth], key)
+		if !ok {
+			return nil, nil, nil, fmt.Errorf(errKey, line.index)
+		}
+
 		groups = append(groups[:line.depth], key)
 
 		if isEmpty(rest) {
+			addDoc(docs, strings.Join(groups, "."), comments[line.index], rest)
 			continue
 		}
 
-		rest, ok := consumeSeparator(rest)
-		if key == "" || !ok && !isEmpty(rest) {
-			return nil, fmt.Errorf(errKey, line.index)
+		rest, ok = consumeSeparator(rest)
+		if !ok && !isEmpty(rest) {
+			return nil, nil, nil, fmt.Errorf(errKey, line.index)
 		}
 
-		value, ok := parseLiteral(rest)
-		if !ok {
-			return nil, fmt.Errorf(errValue, line.index, rest)
+		key = strings.Join(groups, ".")
+
+		if entries, n := readInlineMap(rest); n > 0 && isEmpty(rest[n:]) {
+			// the entries' columns are relative to the opening brace
+			column := line.indent + len(line.content) - len(rest) + 1
+			addDoc(docs, key, comments[line.index], rest[n:])
+
+			for _, e := range entries {
+				output = append(output, assignment{
+					line.index, column + e.offset, key + "." + e.key, e.literal, e.value,
+				})
+			}
+			continue
 		}
 
+		// the elements of repeated groups can only be maps
+		if repeated {
+			return nil, nil, nil, fmt.Errorf(errKey, line.index)
+		}
+
+		value, n := readLiteral(rest)
+		if n == 0 {
+			return nil, nil, nil, literalError(line.index, rest)
+		}
+
+		addDoc(docs, key, comments[line.index], rest[n:])
+
 		output = append(output, assignment{
-			line.index, strings.Join(groups, "."), rest, value,
+			line.index, line.indent + 1, key, rest[:n], value,
 		})
 	}
 
-	return output, nil
+	for _, a := range output {
+		for group := range sections {
+			if conflicts(a.key, group) {
+				return nil, nil, nil, fmt.Errorf(errRepeated, a.key, a.line, group+"[]")
+			}
+		}
+	}
+
+	return output, docs, sections, nil
 }
 
 // Generates a map with (key -> value) pairs for each assignment. Also checks
-// for key name conflicts.
-func initialize(in []assignment) (map[string]interface{}, error) {
+// for key name conflicts. If override is set, a value key may be assigned
+// more than once, the last assignment winning; a warning is returned for
+// each assignment overridden this way.
+func initialize(in []assignment, override bool) (map[string]interface{}, []Warning, error) {
 	out := make(map[string]interface{})
+	warnings := make([]Warning, 0)
+	defined := make(map[string]int)
 
 	for i, a := range in {
 		for j, b := range in {
-			if i == j {
+			if i == j || override && a.key == b.key {
 				continue
 			}
 
@@ -166,15 +298,20 @@ func initialize(in []assignment) (map[string]interface{}, error) {
 					a, b = b, a
 				}
 
-				return nil, fmt.Errorf(errConflict,
+				return nil, nil, fmt.Errorf(errConflict,
 					a.key, a.line, b.key, b.line)
 			}
 		}
 
+		if line, ok := defined[a.key]; ok {
+			warnings = append(warnings, Warning{a.key, fmt.Sprintf(warnOverride, line)})
+		}
+
+		defined[a.key] = a.line
 		out[a.key] = a.value
 	}
 
-	return out, nil
+	return out, warnings, nil
 }
 
 // Returns true if the key b collides with any part of a.
@@ -209,15 +346,50 @@ func selectSpace(in string) (string, string) {
 	return in, ""
 }
 
-// Takes all valid key runes from the beginning of input.
+// Takes the key from the beginning of input, which ends at the first '=',
+// '#' or whitespace outside of a quoted segment.
 func selectKey(in string) (string, string) {
-	for i := 0; i < len(in); i++ {
-		b := in[i]
-		if b == '=' || b == '#' || strings.ContainsRune(Space, rune(b)) {
-			return in[:i], in[i:]
+	n := scanKey(in, "=#")
+	return in[:n], in[n:]
+}
+
+// Returns the length of the key at the beginning of the input. The key ends
+// at the first whitespace or stop byte outside of a quoted segment.
+func scanKey(in, stop string) int {
+	i := 0
+
+	for i < len(in) {
+		if in[i] == '"' {
+			if _, n := readString(in[i:]); n > 0 {
+				i += n
+				continue
+			}
+		}
+
+		if strings.IndexByte(stop, in[i]) >= 0 || strings.ContainsRune(Space, rune(in[i])) {
+			break
 		}
+		i++
 	}
-	return in, ""
+
+	return i
+}
+
+// Returns true if s can be used as a single key segment without quoting it.
+// A trailing "[]" would mark a repeated key group, so it needs quoting too.
+func isValidKey(s string) bool {
+	if s == "" || strings.HasSuffix(s, "[]") {
+		return false
+	}
+
+	for _, ch := range s {
+		if ch == '=' || ch == '#' || ch == '.' || ch == '"' || unicode.IsControl(ch) ||
+			strings.ContainsRune(Space, ch) {
+			return false
+		}
+	}
+
+	return true
 }
 
 // Removes all whitespace and up to one '=' rune from the beginning of the
@@ -240,26 +412,152 @@ func consumeSeparator(in string) (string, bool) {
 	return in[i:], eq
 }
 
-// Attempts to parse s  as any of the known types.
+// Attempts to parse the input as any of the known types. The literal may be
+// followed by whitespace and a comment.
 func parseLiteral(in string) (interface{}, bool) {
-	if v, n := readBool(in); n > 0 && isEmpty(in[n:]) {
-		return v, true
+	v, n := readLiteral(in)
+	return v, n > 0
+}
+
+// Functions reading each of the built-in types, in order of precedence.
+// Readers added with RegisterLiteral are tried after these; see allReaders.
+var readers = []func(in string) (interface{}, int){
+	func(in string) (interface{}, int) { return readBool(in) },
+	func(in string) (interface{}, int) { return readNull(in) },
+	func(in string) (interface{}, int) { return readInt64(in) },
+	func(in string) (interface{}, int) { return readFloat64(in) },
+	func(in string) (interface{}, int) { return readString(in) },
+	func(in string) (interface{}, int) { return readTime(in) },
+	func(in string) (interface{}, int) { return readDate(in) },
+	func(in string) (interface{}, int) { return readTimeOfDay(in) },
+	func(in string) (interface{}, int) { return readDuration(in) },
+	func(in string) (interface{}, int) { return readPeriod(in) },
+	func(in string) (interface{}, int) { return readBytes(in) },
+	func(in string) (interface{}, int) { return readAddr(in) },
+	func(in string) (interface{}, int) { return readPrefix(in) },
+	func(in string) (interface{}, int) { return readAddrPort(in) },
+	func(in string) (interface{}, int) { return readURL(in) },
+	func(in string) (interface{}, int) { return readSecret(in) },
+}
+
+// A key assigned within an inline map.
+type inlineEntry struct {
+	offset  int // of the entry's key, from the start of the map
+	key     string
+	literal string
+	value   interface{}
+}
+
+// Attempts to read an inline map, e.g. "{read = 10, write = 5}", from the
+// beginning of the input. Entries are separated by commas, and their keys
+// are relative to the map's key. Nested maps are flattened, so the entries
+// of "{a = {b = 1}}" and "{a.b = 1}" are the same. Returns the length of the
+// map, which is 0 if the input doesn't start with a valid map.
+func readInlineMap(in string) ([]inlineEntry, int) {
+	if !strings.HasPrefix(in, "{") {
+		return nil, 0
+	}
+
+	entries := make([]inlineEntry, 0)
+
+	n := skipSpace(in, 1)
+	if strings.HasPrefix(in[n:], "}") {
+		return entries, n + 1
 	}
-	if v, n := readInt64(in); n > 0 && isEmpty(in[n:]) {
-		return v, true
+
+	for {
+		start := n
+		n += scanKey(in[n:], "=#,{}")
+
+		// repeated groups can't be defined within inline maps
+		key, ok := parseKey(in[start:n])
+		if !ok || strings.HasSuffix(in[start:n], "[]") {
+			return nil, 0
+		}
+
+		rest, ok := consumeSeparator(in[n:])
+		if !ok {
+			return nil, 0
+		}
+		n = len(in) - len(rest)
+
+		if nested, m := readInlineMap(rest); m > 0 {
+			for _, e := range nested {
+				e.offset += n
+				e.key = key + "." + e.key
+				entries = append(entries, e)
+			}
+			n += m
+		} else {
+			value, m := readInlineValue(rest)
+			if m == 0 {
+				return nil, 0
+			}
+			entries = append(entries, inlineEntry{start, key, rest[:m], value})
+			n += m
+		}
+
+		n = skipSpace(in, n)
+
+		switch {
+		case strings.HasPrefix(in[n:], "}"):
+			return entries, n + 1
+		case strings.HasPrefix(in[n:], ","):
+			n = skipSpace(in, n+1)
+		default:
+			return nil, 0
+		}
 	}
-	if v, n := readFloat64(in); n > 0 && isEmpty(in[n:]) {
-		return v, true
+}
+
+// Reads a literal within an inline map, which must be followed by either a
+// comma or the end of the map.
+func readInlineValue(in string) (interface{}, int) {
+	for _, read := range allReaders() {
+		v, n := read(in)
+		if n == 0 {
+			continue
+		}
+
+		if next := skipSpace(in, n); next < len(in) && (in[next] == ',' || in[next] == '}') {
+			return v, n
+		}
 	}
-	if v, n := readString(in); n > 0 && isEmpty(in[n:]) {
-		return v, true
+
+	return nil, 0
+}
+
+// Returns the index of the first non-whitespace byte at or after i.
+func skipSpace(in string, i int) int {
+	for i < len(in) && strings.ContainsRune(Space, rune(in[i])) {
+		i++
 	}
-	if v, n := readTime(in); n > 0 && isEmpty(in[n:]) {
-		return v, true
+	return i
+}
+
+// Describes why the input on the given line isn't a valid literal. Malformed
+// integers and addresses get a more specific error than other invalid
+// values.
+func literalError(index int, in string) error {
+	if _, n, err := scanInt64(in); err != nil && isEmpty(in[n:]) {
+		return fmt.Errorf(errInt, index, in[:n], err)
 	}
-	if v, n := readDuration(in); n > 0 && isEmpty(in[n:]) {
-		return v, true
+	if token, err := checkAddr(in); err != nil && isEmpty(in[len(token):]) {
+		return fmt.Errorf(errAddr, index, token, err)
+	}
+
+	return fmt.Errorf(errValue, index, in)
+}
+
+// Like parseLiteral, but also returns the length of the literal, excluding
+// any trailing whitespace and comment. The length is 0 if the input isn't
+// a valid literal.
+func readLiteral(in string) (interface{}, int) {
+	for _, read := range allReaders() {
+		if v, n := read(in); n > 0 && isEmpty(in[n:]) {
+			return v, n
+		}
 	}
 
-	return nil, false
+	return nil, 0
 }
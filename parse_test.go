@@ -2,6 +2,9 @@ package walnut
 
 import (
 	"fmt"
+	"net/netip"
+	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
 	"time"
@@ -14,12 +17,12 @@ var splitTests = []struct {
 }{
 	{"", []line{}, nil},
 	{"# comment", []line{}, nil},
-	{"\n\na=1\n\n", []line{{3, 0, "a=1"}}, nil},
-	{"a=1\nb=2", []line{{1, 0, "a=1"}, {2, 0, "b=2"}}, nil},
-	{"a=1\na=1", []line{{1, 0, "a=1"}, {2, 0, "a=1"}}, nil},
-	{"a=1\n b=2", []line{{1, 0, "a=1"}, {2, 1, "b=2"}}, nil},
-	{"a=1\n\tb=2", []line{{1, 0, "a=1"}, {2, 1, "b=2"}}, nil},
-	{"a=1\n\t \n\tb=2", []line{{1, 0, "a=1"}, {3, 1, "b=2"}}, nil},
+	{"\n\na=1\n\n", []line{{3, 0, "a=1", 0}}, nil},
+	{"a=1\nb=2", []line{{1, 0, "a=1", 0}, {2, 0, "b=2", 0}}, nil},
+	{"a=1\na=1", []line{{1, 0, "a=1", 0}, {2, 0, "a=1", 0}}, nil},
+	{"a=1\n b=2", []line{{1, 0, "a=1", 0}, {2, 1, "b=2", 1}}, nil},
+	{"a=1\n\tb=2", []line{{1, 0, "a=1", 0}, {2, 1, "b=2", 1}}, nil},
+	{"a=1\n\t \n\tb=2", []line{{1, 0, "a=1", 0}, {3, 1, "b=2", 1}}, nil},
 	{"\n\t\t\n\n ", []line{}, nil},
 	{" a=1", nil, fmt.Errorf(errIndent, 1)},
 	{"a=1\n  b=2\n c=3", nil, fmt.Errorf(errIndent, 3)},
@@ -43,100 +46,163 @@ var interpretTests = []struct {
 	err error
 }{
 	{
-		[]line{{3, 0, "a=1"}},
-		[]assignment{{3, "a", "1", int64(1)}},
+		[]line{{3, 0, "a=1", 0}},
+		[]assignment{{3, 1, "a", "1", int64(1)}},
 		nil,
 	},
 	{
-		[]line{{1, 0, "b=2"}, {2, 0, "c=3"}},
-		[]assignment{{1, "b", "2", int64(2)}, {2, "c", "3", int64(3)}},
+		[]line{{1, 0, "b=2", 0}, {2, 0, "c=3", 0}},
+		[]assignment{{1, 1, "b", "2", int64(2)}, {2, 1, "c", "3", int64(3)}},
 		nil,
 	},
 	{
-		[]line{{1, 0, "d"}, {2, 1, "e=4"}},
+		[]line{{1, 0, "d", 0}, {2, 1, "e=4", 1}},
 		[]assignment{
-			{2, "d.e", "4", int64(4)},
+			{2, 2, "d.e", "4", int64(4)},
 		},
 		nil,
 	},
 	{
-		[]line{{1, 0, "foo"}, {2, 1, "bar=5"}, {3, 1, "baz=6"}},
+		[]line{{1, 0, "foo", 0}, {2, 1, "bar=5", 1}, {3, 1, "baz=6", 1}},
 		[]assignment{
-			{2, "foo.bar", "5", int64(5)},
-			{3, "foo.baz", "6", int64(6)},
+			{2, 2, "foo.bar", "5", int64(5)},
+			{3, 2, "foo.baz", "6", int64(6)},
 		},
 		nil,
 	},
 	{
-		[]line{{1, 0, "group#snug"}, {3, 1, "key=\"test\"#snug"}},
+		[]line{{1, 0, "group#snug", 0}, {3, 1, "key=\"test\"#snug", 1}},
 		[]assignment{
-			{3, "group.key", "\"test\"#snug", "test"},
+			{3, 2, "group.key", "\"test\"", "test"},
 		},
 		nil,
 	},
 	{
-		[]line{{1, 0, "bool = true"}},
+		[]line{{1, 0, "bool = true", 0}},
 		[]assignment{
-			{1, "bool", "true", true},
+			{1, 1, "bool", "true", true},
 		},
 		nil,
 	},
 	{
-		[]line{{1, 0, "int64 = 12345"}},
+		[]line{{1, 0, "int64 = 12345", 0}},
 		[]assignment{
-			{1, "int64", "12345", int64(12345)},
+			{1, 1, "int64", "12345", int64(12345)},
 		},
 		nil,
 	},
 	{
-		[]line{{1, 0, "float64 = 123.45"}},
+		[]line{{1, 0, "float64 = 123.45", 0}},
 		[]assignment{
-			{1, "float64", "123.45", float64(123.45)},
+			{1, 1, "float64", "123.45", float64(123.45)},
 		},
 		nil,
 	},
 	{
-		[]line{{1, 0, "string = \"hello\""}},
+		[]line{{1, 0, "string = \"hello\"", 0}},
 		[]assignment{
-			{1, "string", "\"hello\"", "hello"},
+			{1, 1, "string", "\"hello\"", "hello"},
 		},
 		nil,
 	},
 	{
-		[]line{{1, 0, "time = 2012-01-02 15:30:28.000000000789 +0000"}},
+		[]line{{1, 0, "time = 2012-01-02 15:30:28.000000000789 +0000", 0}},
 		func() []assignment {
 			raw := "2012-01-02 15:30:28.000000000789 +0000"
 			t, _ := time.Parse("2006-01-02 15:04:05 -0700", raw)
-			return []assignment{{1, "time", raw, t}}
+			return []assignment{{1, 1, "time", raw, t}}
 		}(),
 		nil,
 	},
 	{
-		[]line{{1, 0, "duration = 10m 20s"}},
+		[]line{{1, 0, "duration = 10m 20s", 0}},
 		[]assignment{
-			{1, "duration", "10m 20s", 10*time.Minute + 20*time.Second},
+			{1, 1, "duration", "10m 20s", 10*time.Minute + 20*time.Second},
 		},
 		nil,
 	},
 	{
-		[]line{{1, 0, "♫ = 123"}},
+		[]line{{1, 0, "♫ = 123", 0}},
 		[]assignment{
-			{1, "♫", "123", int64(123)},
+			{1, 1, "♫", "123", int64(123)},
 		},
 		nil,
 	},
-	{[]line{{1, 0, "=1"}}, nil, fmt.Errorf(errKey, 1)},
-	{[]line{{1, 0, " = 1"}}, nil, fmt.Errorf(errKey, 1)},
-	{[]line{{1, 0, "== 1"}}, nil, fmt.Errorf(errKey, 1)},
-	{[]line{{1, 0, "a b = 1"}}, nil, fmt.Errorf(errKey, 1)},
-	{[]line{{1, 0, "a\tb"}}, nil, fmt.Errorf(errKey, 1)},
-	{[]line{{1, 0, "a = 0 0"}}, nil, fmt.Errorf(errValue, 1, "0 0")},
-	{[]line{{1, 0, "a == 0"}}, nil, fmt.Errorf(errValue, 1, "= 0")},
+	{
+		[]line{{1, 0, "limits = {read = 10, write = 5}", 0}},
+		[]assignment{
+			{1, 11, "limits.read", "10", int64(10)},
+			{1, 22, "limits.write", "5", int64(5)},
+		},
+		nil,
+	},
+	{
+		[]line{{1, 0, "a", 0}, {2, 1, "b = {c = {d = 1h 30m}, e.f=\"}\",g = null} # ok", 2}},
+		[]assignment{
+			{2, 13, "a.b.c.d", "1h 30m", 90 * time.Minute},
+			{2, 26, "a.b.e.f", `"}"`, "}"},
+			{2, 34, "a.b.g", "null", Null{}},
+		},
+		nil,
+	},
+	{
+		[]line{{1, 0, `backends."api.example.com".weight = 2`, 0}},
+		[]assignment{{1, 1, `backends."api.example.com".weight`, "2", int64(2)}},
+		nil,
+	},
+	{
+		[]line{{1, 0, `"my label" # group`, 0}, {2, 1, `"a=b" = 1`, 2}, {3, 1, `"plain" = 2`, 2}},
+		[]assignment{
+			{2, 3, `"my label"."a=b"`, "1", int64(1)},
+			{3, 3, `"my label".plain`, "2", int64(2)},
+		},
+		nil,
+	},
+	{
+		[]line{{1, 0, `a = {"b.c" = 1, d."e f" = 2}`, 0}},
+		[]assignment{
+			{1, 6, `a."b.c"`, "1", int64(1)},
+			{1, 17, `a.d."e f"`, "2", int64(2)},
+		},
+		nil,
+	},
+	{[]line{{1, 0, `a."b = 1`, 0}}, nil, fmt.Errorf(errKey, 1)},
+	{[]line{{1, 0, `a"b" = 1`, 0}}, nil, fmt.Errorf(errKey, 1)},
+	{[]line{{1, 0, `"a""b" = 1`, 0}}, nil, fmt.Errorf(errKey, 1)},
+	{[]line{{1, 0, "a..b = 1", 0}}, nil, fmt.Errorf(errKey, 1)},
+	{[]line{{1, 0, "a. = 1", 0}}, nil, fmt.Errorf(errKey, 1)},
+	{[]line{{1, 0, "a = {}", 0}}, []assignment{}, nil},
+	{[]line{{1, 0, "a = { }", 0}}, []assignment{}, nil},
+	{[]line{{1, 0, "a = {b = 1,}", 0}}, nil, fmt.Errorf(errValue, 1, "{b = 1,}")},
+	{[]line{{1, 0, "a = {b = 1", 0}}, nil, fmt.Errorf(errValue, 1, "{b = 1")},
+	{[]line{{1, 0, "a = {b 1}", 0}}, nil, fmt.Errorf(errValue, 1, "{b 1}")},
+	{[]line{{1, 0, "a = {= 1}", 0}}, nil, fmt.Errorf(errValue, 1, "{= 1}")},
+	{[]line{{1, 0, "a = {b = 1} 2", 0}}, nil, fmt.Errorf(errValue, 1, "{b = 1} 2")},
+	{[]line{{1, 0, "a = {b = 1 c = 2}", 0}}, nil, fmt.Errorf(errValue, 1, "{b = 1 c = 2}")},
+	{[]line{{1, 0, "=1", 0}}, nil, fmt.Errorf(errKey, 1)},
+	{[]line{{1, 0, " = 1", 0}}, nil, fmt.Errorf(errKey, 1)},
+	{[]line{{1, 0, "== 1", 0}}, nil, fmt.Errorf(errKey, 1)},
+	{[]line{{1, 0, "a b = 1", 0}}, nil, fmt.Errorf(errKey, 1)},
+	{[]line{{1, 0, "a\tb", 0}}, nil, fmt.Errorf(errKey, 1)},
+	{[]line{{1, 0, "a = 0 0", 0}}, nil, fmt.Errorf(errValue, 1, "0 0")},
+	{[]line{{1, 0, "a == 0", 0}}, nil, fmt.Errorf(errValue, 1, "= 0")},
+	{[]line{{1, 0, "a = 0755", 0}}, nil, fmt.Errorf(errInt, 1, "0755", "leading zeros are ambiguous, use 0o for octal")},
+	{[]line{{1, 0, "a = 0x # hex", 0}}, nil, fmt.Errorf(errInt, 1, "0x", `missing digits after "0x"`)},
+	{[]line{{1, 0, "a = 0755 ms", 0}}, nil, fmt.Errorf(errValue, 1, "0755 ms")},
+	{[]line{{1, 0, "a = 10.0.0.256", 0}}, nil, fmt.Errorf(errAddr, 1, "10.0.0.256", addrError(netip.ParseAddr("10.0.0.256")))},
+	{[]line{{1, 0, "a = 10.0.0.0/33 # net", 0}}, nil, fmt.Errorf(errAddr, 1, "10.0.0.0/33", addrError(netip.ParsePrefix("10.0.0.0/33")))},
+	{[]line{{1, 0, "a = [::1]:99999", 0}}, nil, fmt.Errorf(errAddr, 1, "[::1]:99999", addrError(netip.ParseAddrPort("[::1]:99999")))},
+	{[]line{{1, 0, "a = 1.2.3", 0}}, nil, fmt.Errorf(errValue, 1, "1.2.3")},
+}
+
+// Returns the error from one of the netip parsing functions.
+func addrError[T any](_ T, err error) error {
+	return err
 }
 
 func TestInterpret(t *testing.T) {
 	for _, test := range interpretTests {
-		out, err := interpret(test.in)
+		out, _, _, err := interpret(test.in, nil)
 		if !eq(out, test.out) || !eq(err, test.err) {
 			t.Errorf("interpret(%+v):", test.in)
 			t.Errorf("   got %+v, %v", out, err)
@@ -151,14 +217,14 @@ var initializeTests = []struct {
 	err error
 }{
 	{
-		[]assignment{{1, "a", "1", int64(1)}},
+		[]assignment{{1, 1, "a", "1", int64(1)}},
 		map[string]interface{}{
 			"a": int64(1),
 		},
 		nil,
 	},
 	{
-		[]assignment{{1, "foo.bar", "2", int64(2)}, {1, "foo.baz", "3", int64(3)}},
+		[]assignment{{1, 1, "foo.bar", "2", int64(2)}, {1, 1, "foo.baz", "3", int64(3)}},
 		map[string]interface{}{
 			"foo.bar": int64(2),
 			"foo.baz": int64(3),
@@ -166,22 +232,22 @@ var initializeTests = []struct {
 		nil,
 	},
 	{
-		[]assignment{{1, "a", "1", int64(1)}, {2, "a.b", "2", int64(2)}},
+		[]assignment{{1, 1, "a", "1", int64(1)}, {2, 1, "a.b", "2", int64(2)}},
 		nil,
 		fmt.Errorf(errConflict, "a.b", 2, "a", 1),
 	},
 	{
-		[]assignment{{1, "a", "1", int64(1)}, {2, "a", "1", int64(1)}},
+		[]assignment{{1, 1, "a", "1", int64(1)}, {2, 1, "a", "1", int64(1)}},
 		nil,
 		fmt.Errorf(errConflict, "a", 2, "a", 1),
 	},
 	{
-		[]assignment{{1, "a.b.c", "1", int64(1)}, {2, "a.b", "2", int64(2)}},
+		[]assignment{{1, 1, "a.b.c", "1", int64(1)}, {2, 1, "a.b", "2", int64(2)}},
 		nil,
 		fmt.Errorf(errConflict, "a.b", 2, "a.b.c", 1),
 	},
 	{
-		[]assignment{{1, "a.b", "1", int64(1)}, {2, "a.b.c", "2", int64(2)}},
+		[]assignment{{1, 1, "a.b", "1", int64(1)}, {2, 1, "a.b.c", "2", int64(2)}},
 		nil,
 		fmt.Errorf(errConflict, "a.b.c", 2, "a.b", 1),
 	},
@@ -189,7 +255,7 @@ var initializeTests = []struct {
 
 func TestInitialize(t *testing.T) {
 	for _, test := range initializeTests {
-		out, err := initialize(test.in)
+		out, _, err := initialize(test.in, false)
 		if !eq(out, test.out) || !eq(err, test.err) {
 			t.Errorf("initialize(%+v):", test.in)
 			t.Errorf("   got %+v, %v", out, err)
@@ -198,6 +264,120 @@ func TestInitialize(t *testing.T) {
 	}
 }
 
+var initializeOverrideTests = []struct {
+	in       []assignment
+	out      map[string]interface{}
+	warnings []Warning
+	err      error
+}{
+	{
+		[]assignment{{1, 1, "a", "1", int64(1)}, {2, 1, "a", "2", int64(2)}, {5, 1, "a", "3", int64(3)}},
+		map[string]interface{}{
+			"a": int64(3),
+		},
+		[]Warning{{"a", fmt.Sprintf(warnOverride, 1)}, {"a", fmt.Sprintf(warnOverride, 2)}},
+		nil,
+	},
+	{
+		[]assignment{{1, 1, "a.b", "1", int64(1)}, {2, 1, "a.c", "2", int64(2)}},
+		map[string]interface{}{
+			"a.b": int64(1),
+			"a.c": int64(2),
+		},
+		[]Warning{},
+		nil,
+	},
+	{
+		[]assignment{{1, 1, "a.b", "1", int64(1)}, {2, 1, "a.b", "2", int64(2)}, {3, 1, "a.b.c", "3", int64(3)}},
+		nil,
+		nil,
+		fmt.Errorf(errConflict, "a.b.c", 3, "a.b", 1),
+	},
+	{
+		[]assignment{{1, 1, "a.b.c", "1", int64(1)}, {2, 1, "a.b", "2", int64(2)}},
+		nil,
+		nil,
+		fmt.Errorf(errConflict, "a.b", 2, "a.b.c", 1),
+	},
+}
+
+func TestInitializeOverride(t *testing.T) {
+	for _, test := range initializeOverrideTests {
+		out, warnings, err := initialize(test.in, true)
+		if !eq(out, test.out) || !eq(warnings, test.warnings) || !eq(err, test.err) {
+			t.Errorf("initialize(%+v, true):", test.in)
+			t.Errorf("   got %+v, %v, %v", out, warnings, err)
+			t.Errorf("  want %+v, %v, %v", test.out, test.warnings, test.err)
+		}
+	}
+}
+
+func TestReadWithOverride(t *testing.T) {
+	src := []byte("http\n  port = 80\n  host = \"a\"\nhttp.port = 8080\n")
+
+	if _, _, err := ReadWith(src, nil); !eq(err, fmt.Errorf(errConflict, "http.port", 4, "http.port", 2)) {
+		t.Errorf("ReadWith(%q, nil): got %v, want a conflict", src, err)
+	}
+
+	conf, warnings, err := ReadWith(src, &ReadOptions{Override: true})
+	if err != nil {
+		t.Fatalf("ReadWith(%q): %v", src, err)
+	}
+
+	if got := conf.Int64("http.port"); got != 8080 {
+		t.Errorf("http.port: got %d, want 8080", got)
+	}
+	if p, _ := conf.Position("http.port"); p.Line != 4 {
+		t.Errorf("position of http.port: got line %d, want 4", p.Line)
+	}
+
+	want := []Warning{{"http.port", fmt.Sprintf(warnOverride, 2)}}
+	if !eq(warnings, want) {
+		t.Errorf("warnings:")
+		t.Errorf("   got %v", warnings)
+		t.Errorf("  want %v", want)
+	}
+}
+
+func TestLoadWith(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "conf.wn")
+	src := "@if env == \"prod\"\n  port = 80\nport = 8080\npassword = secret(\"db\")\n"
+
+	if err := os.WriteFile(path, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := &ReadOptions{
+		Override: true,
+		Vars:     map[string]string{"env": "prod"},
+		Secrets:  mapSecrets{"db": "hunter2"},
+	}
+	conf, warnings, err := LoadWith(path, opts)
+	if err != nil {
+		t.Fatalf("LoadWith(%q): %v", path, err)
+	}
+
+	if got := conf.Int64("port"); got != 8080 {
+		t.Errorf("port: got %d, want 8080", got)
+	}
+	if got := conf.Secret("password").Reveal(); got != "hunter2" {
+		t.Errorf("password: got %q, want %q", got, "hunter2")
+	}
+	if p, _ := conf.Position("port"); p.File != path || p.Line != 3 {
+		t.Errorf("position of port: got %v, want line 3 of %q", p, path)
+	}
+	if len(warnings) != 1 {
+		t.Errorf("warnings: got %v, want one", warnings)
+	}
+
+	if _, _, err := LoadWith(path, nil); !eq(err, fmt.Errorf(errVariable, "env", 1)) {
+		t.Errorf("LoadWith(%q, nil): got %v, want an undefined variable", path, err)
+	}
+	if _, _, err := LoadWith(filepath.Join(path, "missing"), nil); err == nil {
+		t.Errorf("LoadWith of a missing file: got no error")
+	}
+}
+
 // shorthand for reflect.DeepEqual
 func eq(a, b interface{}) bool {
 	return reflect.DeepEqual(a, b)
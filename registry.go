@@ -0,0 +1,126 @@
+package walnut
+
+import (
+	"fmt"
+	"net/netip"
+	"net/url"
+	"reflect"
+	"sync"
+	"time"
+)
+
+const (
+	errRegisterNil     = "walnut: RegisterLiteral called with a nil reader for %s"
+	errRegisterBuiltin = "walnut: %s is a built-in literal type"
+	errRegisterTwice   = "walnut: a reader for %s is already registered"
+)
+
+// A literal type added with RegisterLiteral.
+type customLiteral struct {
+	typ  reflect.Type
+	read func(in string) (interface{}, int)
+}
+
+var registry struct {
+	sync.RWMutex
+	literals []customLiteral
+}
+
+// Types with built-in readers, which can't be registered again.
+var builtinTypes = map[reflect.Type]bool{
+	reflect.TypeOf(false):            true,
+	reflect.TypeOf(Null{}):           true,
+	reflect.TypeOf(int64(0)):         true,
+	reflect.TypeOf(float64(0)):       true,
+	reflect.TypeOf(""):               true,
+	reflect.TypeOf(time.Time{}):      true,
+	reflect.TypeOf(Date{}):           true,
+	reflect.TypeOf(TimeOfDay{}):      true,
+	reflect.TypeOf(time.Duration(0)): true,
+	reflect.TypeOf(Period{}):         true,
+	reflect.TypeOf(ByteSize(0)):      true,
+	reflect.TypeOf(netip.Addr{}):     true,
+	reflect.TypeOf(netip.Prefix{}):   true,
+	reflect.TypeOf(netip.AddrPort{}): true,
+	reflect.TypeOf(&url.URL{}):       true,
+	reflect.TypeOf(Secret{}):         true,
+}
+
+// Registers a reader for an additional literal type. Like the built-in
+// readers, it attempts to extract a value from the beginning of the input,
+// returning the value and the length of its literal, or a length of 0 if
+// the input doesn't start with one.
+//
+// Registered readers are tried after the built-in ones, in the order they
+// were registered, so they can't change the meaning of literals which are
+// already valid. Values of the new type can be retrieved with Value.
+//
+// If T implements fmt.Stringer, and its String method returns a literal the
+// reader accepts, values of the type can also be written by File.Set and
+// exported to other formats.
+//
+// RegisterLiteral panics if read is nil, if T is a built-in literal type,
+// or if a reader for T is already registered. It's meant to be called
+// during initialization, before any configuration is read.
+func RegisterLiteral[T any](read func(in string) (T, int)) {
+	typ := reflect.TypeOf((*T)(nil)).Elem()
+
+	if read == nil {
+		panic(fmt.Sprintf(errRegisterNil, typ))
+	}
+	if builtinTypes[typ] {
+		panic(fmt.Sprintf(errRegisterBuiltin, typ))
+	}
+
+	registry.Lock()
+	defer registry.Unlock()
+
+	for _, custom := range registry.literals {
+		if custom.typ == typ {
+			panic(fmt.Sprintf(errRegisterTwice, typ))
+		}
+	}
+
+	registry.literals = append(registry.literals, customLiteral{
+		typ,
+		func(in string) (interface{}, int) { return read(in) },
+	})
+}
+
+// Returns the readers for every literal type, built-in ones first, in
+// order of precedence.
+func allReaders() []func(in string) (interface{}, int) {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	if len(registry.literals) == 0 {
+		return readers
+	}
+
+	all := make([]func(in string) (interface{}, int), 0, len(readers)+len(registry.literals))
+	all = append(all, readers...)
+	for _, custom := range registry.literals {
+		all = append(all, custom.read)
+	}
+
+	return all
+}
+
+// Formats a value of a registered type using its String method. Returns
+// false if the type isn't registered, has no String method, or if the
+// result isn't read back as a value of the type, e.g. because a built-in
+// literal takes precedence.
+func formatCustom(v interface{}) (string, bool) {
+	s, ok := v.(fmt.Stringer)
+	if !ok || builtinTypes[reflect.TypeOf(v)] {
+		return "", false
+	}
+
+	// only registered types are read back as themselves
+	literal := s.String()
+	if read, n := readLiteral(literal); n > 0 && n == len(literal) && reflect.TypeOf(read) == reflect.TypeOf(v) {
+		return literal, true
+	}
+
+	return "", false
+}
@@ -0,0 +1,206 @@
+package walnut
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"testing"
+)
+
+// A semantic version, registered as a literal type for these tests.
+type testVersion struct {
+	Major, Minor, Patch int
+}
+
+func (v testVersion) String() string {
+	return fmt.Sprintf("v%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+var reTestVersion = regexp.MustCompile(`^v(\d+)\.(\d+)\.(\d+)`)
+
+func readTestVersion(in string) (testVersion, int) {
+	m := reTestVersion.FindStringSubmatch(in)
+	if m == nil {
+		return testVersion{}, 0
+	}
+
+	var v testVersion
+	v.Major, _ = strconv.Atoi(m[1])
+	v.Minor, _ = strconv.Atoi(m[2])
+	v.Patch, _ = strconv.Atoi(m[3])
+
+	return v, len(m[0])
+}
+
+// A type whose literals overlap with integers, which take precedence.
+type testShadowed int
+
+func readTestShadowed(in string) (testShadowed, int) {
+	v, n := readInt64(in)
+	return testShadowed(v), n
+}
+
+// Only types which don't overlap with built-in literals are registered for
+// all tests; others are registered with registerLiteral.
+func init() {
+	RegisterLiteral(readTestVersion)
+}
+
+// Registers a literal type for the duration of a test.
+func registerLiteral[T any](t *testing.T, read func(in string) (T, int)) {
+	registry.RLock()
+	saved := registry.literals
+	registry.RUnlock()
+
+	RegisterLiteral(read)
+
+	t.Cleanup(func() {
+		registry.Lock()
+		registry.literals = saved
+		registry.Unlock()
+	})
+}
+
+var customLiteralTests = []struct {
+	in   string
+	want interface{}
+}{
+	{"a = v1.2.3", testVersion{1, 2, 3}},
+	{"a = v1.2.3 # comment", testVersion{1, 2, 3}},
+	{"a = 12", int64(12)},
+}
+
+func TestCustomLiteral(t *testing.T) {
+	registerLiteral(t, readTestShadowed)
+
+	for _, test := range customLiteralTests {
+		conf, err := Read([]byte(test.in))
+		if err != nil {
+			t.Errorf("Read(%q): %v", test.in, err)
+			continue
+		}
+
+		if got, _ := conf.Get("a"); got != test.want {
+			t.Errorf("Read(%q).Get(\"a\"):", test.in)
+			t.Errorf("   got %#v", got)
+			t.Errorf("  want %#v", test.want)
+		}
+	}
+
+	conf, _ := Read([]byte("a = {b = v0.1.0}"))
+	if got, _ := conf.Get("a.b"); got != (testVersion{0, 1, 0}) {
+		t.Errorf("inline map with a custom literal:")
+		t.Errorf("   got %#v", got)
+		t.Errorf("  want %#v", testVersion{0, 1, 0})
+	}
+
+	if _, err := Read([]byte("a = v1.2")); err == nil {
+		t.Errorf("Read(%q): expected an error", "a = v1.2")
+	}
+}
+
+var stringLiteralTests = []struct {
+	in   string
+	want string
+}{
+	{"hello", `"hello"`},
+	{"5s", "5s"},
+	{"v1.2.3", "v1.2.3"},
+	{"12", `"12"`},
+	{"1_000", `"1_000"`},
+	{"v1.2", `"v1.2"`},
+}
+
+func TestStringLiteral(t *testing.T) {
+	registerLiteral(t, readTestShadowed)
+
+	for _, test := range stringLiteralTests {
+		if got := stringLiteral(test.in); got != test.want {
+			t.Errorf("stringLiteral(%q):", test.in)
+			t.Errorf("   got %s", got)
+			t.Errorf("  want %s", test.want)
+		}
+	}
+
+	src, _, err := FromYAML([]byte(`a: "1_000"`))
+	if want := "a = \"1_000\"\n"; string(src) != want || err != nil {
+		t.Errorf("FromYAML(%q):", `a: "1_000"`)
+		t.Errorf("   got %q, %v", src, err)
+		t.Errorf("  want %q, %v", want, nil)
+	}
+}
+
+func TestRegisterLiteralPanics(t *testing.T) {
+	tests := map[string]func(){
+		"nil":      func() { RegisterLiteral[testVersion](nil) },
+		"builtin":  func() { RegisterLiteral(readInt64) },
+		"repeated": func() { RegisterLiteral(readTestVersion) },
+	}
+
+	for name, register := range tests {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("RegisterLiteral (%s) didn't panic", name)
+				}
+			}()
+			register()
+		}()
+	}
+}
+
+var valueTests = []struct {
+	key  string
+	want testVersion
+	err  error
+}{
+	{"undefined", testVersion{}, fmt.Errorf(errUndefined, "undefined")},
+	{"int", testVersion{}, fmt.Errorf(errWrongType, "int", "int64", "walnut.testVersion")},
+	{"version", testVersion{2, 0, 1}, nil},
+}
+
+func TestValue(t *testing.T) {
+	conf, err := Read([]byte("int = 1\nversion = v2.0.1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range valueTests {
+		got, err := Value[testVersion](conf, test.key)
+		if got != test.want || !eq(err, test.err) {
+			t.Errorf("Value(%q):", test.key)
+			t.Errorf("   got %#v, %v", got, err)
+			t.Errorf("  want %#v, %v", test.want, test.err)
+		}
+	}
+
+	if got, err := Value[int64](conf, "int"); got != 1 || err != nil {
+		t.Errorf("Value[int64](\"int\"):")
+		t.Errorf("   got %#v, %v", got, err)
+		t.Errorf("  want %#v, %v", int64(1), nil)
+	}
+}
+
+func TestCustomLiteralConversion(t *testing.T) {
+	conf := &config{data: map[string]interface{}{"a": testVersion{1, 2, 3}}}
+
+	js, _, err := ToJSON(conf)
+	if err != nil {
+		t.Fatalf("ToJSON: %v", err)
+	}
+
+	src, err := FromJSON(js)
+	if err != nil || string(src) != "a = v1.2.3\n" {
+		t.Errorf("FromJSON(%s):", js)
+		t.Errorf("   got %q, %v", src, err)
+		t.Errorf("  want %q, %v", "a = v1.2.3\n", nil)
+	}
+
+	_, warnings, _ := ToTOML(conf)
+	want := []Warning{{"a", "walnut.testVersion converted to a string"}}
+	if !sameWarnings(warnings, want) {
+		t.Errorf("ToTOML warnings:")
+		t.Errorf("   got %v", warnings)
+		t.Errorf("  want %v", want)
+	}
+}
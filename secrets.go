@@ -0,0 +1,120 @@
+package walnut
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	errNoSecrets  = "secret %q on line %d cannot be resolved without a SecretProvider"
+	errSecret     = "cannot resolve secret %q on line %d: %v"
+	errSecretName = "%q is not a valid secret name"
+)
+
+// A Secret is a value resolved from a secret reference, such as
+// `secret("db/password")`, when the configuration is read. To keep it from
+// being logged by accident, the fmt package prints a Secret as its
+// reference; its value is only available through Reveal.
+type Secret struct {
+	name  string
+	value string
+}
+
+// Returns the name the secret was referred to by.
+func (s Secret) Name() string {
+	return s.name
+}
+
+// Returns the secret's value.
+func (s Secret) Reveal() string {
+	return s.value
+}
+
+// Returns the secret's reference, e.g. `secret("db/password")`.
+func (s Secret) String() string {
+	return "secret(" + strconv.Quote(s.name) + ")"
+}
+
+// Returns the secret's reference, so that it's redacted by "%#v" as well.
+func (s Secret) GoString() string {
+	return s.String()
+}
+
+// Encodes the secret as Redacted, rather than its value.
+func (s Secret) MarshalText() ([]byte, error) {
+	return []byte(Redacted), nil
+}
+
+// A SecretProvider resolves the names of secret references to their values.
+type SecretProvider interface {
+	Secret(name string) (string, error)
+}
+
+// A SecretProvider reading secrets from files.
+type fileSecrets struct {
+	dir string
+}
+
+// Returns a SecretProvider which reads each secret from a file in dir, named
+// by the secret: `secret("db/password")` is read from dir/db/password, as
+// with secrets mounted at /run/secrets by Docker or Kubernetes. A single
+// trailing line break is removed from the file's contents. Names must be
+// relative, slash-separated paths which don't leave dir.
+func FileSecrets(dir string) SecretProvider {
+	return fileSecrets{dir}
+}
+
+func (p fileSecrets) Secret(name string) (string, error) {
+	path := filepath.FromSlash(name)
+	if !filepath.IsLocal(path) {
+		return "", fmt.Errorf(errSecretName, name)
+	}
+
+	b, err := os.ReadFile(filepath.Join(p.dir, path))
+	if err != nil {
+		return "", err
+	}
+
+	s := strings.TrimSuffix(string(b), "\n")
+	return strings.TrimSuffix(s, "\r"), nil
+}
+
+// Resolves all secret references in a table, using the provider. Returns an
+// error if a reference can't be resolved.
+func resolveSecrets(table map[string]interface{}, positions map[string]Position, provider SecretProvider) error {
+	keys := make([]string, 0)
+	for key, v := range table {
+		if _, ok := v.(Secret); ok {
+			keys = append(keys, key)
+		}
+	}
+
+	// report errors in a predictable order
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := positions[keys[i]], positions[keys[j]]
+		return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+	})
+
+	for _, key := range keys {
+		s := table[key].(Secret)
+		line := positions[key].Line
+
+		if provider == nil {
+			return fmt.Errorf(errNoSecrets, s.name, line)
+		}
+
+		value, err := provider.Secret(s.name)
+		if err != nil {
+			return fmt.Errorf(errSecret, s.name, line, err)
+		}
+
+		s.value = value
+		table[key] = s
+	}
+
+	return nil
+}
@@ -0,0 +1,119 @@
+package walnut
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// A SecretProvider backed by a map.
+type mapSecrets map[string]string
+
+func (m mapSecrets) Secret(name string) (string, error) {
+	v, ok := m[name]
+	if !ok {
+		return "", errors.New("no such secret")
+	}
+	return v, nil
+}
+
+func TestReadSecrets(t *testing.T) {
+	src := []byte("db\n  user = \"app\"\n  password = secret(\"db/password\")\napi = {token = secret(\"api\")}\n")
+	secrets := mapSecrets{"db/password": "hunter2", "api": "t0ken"}
+
+	conf, _, err := ReadWith(src, &ReadOptions{Secrets: secrets})
+	if err != nil {
+		t.Fatalf("ReadWith: %v", err)
+	}
+
+	s := conf.Secret("db.password")
+	if s.Reveal() != "hunter2" || s.Name() != "db/password" {
+		t.Errorf("Config.Secret(%q): got %q, %q, want %q, %q", "db.password", s.Name(), s.Reveal(), "db/password", "hunter2")
+	}
+	if got := conf.Select("api").Secret("token").Reveal(); got != "t0ken" {
+		t.Errorf("Config.Secret(%q): got %q, want %q", "api.token", got, "t0ken")
+	}
+
+	// none of the usual ways of printing a value may reveal it
+	printed := []string{
+		fmt.Sprint(s),
+		fmt.Sprintf("%v %+v %#v %s", s, s, s, s),
+		fmt.Sprintf("%v", struct{ S Secret }{s}),
+	}
+	if b, err := json.Marshal(s); err == nil {
+		printed = append(printed, string(b))
+	}
+	if b, _ := s.MarshalText(); string(b) != Redacted {
+		t.Errorf("Secret.MarshalText: got %q, want %q", b, Redacted)
+	}
+	if js, _, err := ToJSON(conf); err == nil {
+		printed = append(printed, string(js))
+	}
+	if yml, _, err := ToYAML(conf); err == nil {
+		printed = append(printed, string(yml))
+	}
+	if env, err := Environ(conf, nil); err == nil {
+		printed = append(printed, strings.Join(env, "\n"))
+	}
+
+	for _, p := range printed {
+		if strings.Contains(p, "hunter2") || strings.Contains(p, "t0ken") {
+			t.Errorf("secret revealed in %q", p)
+		}
+	}
+
+	if p, _ := conf.Position("db.password"); p.Literal != `secret("db/password")` {
+		t.Errorf("Position(%q).Literal: got %q", "db.password", p.Literal)
+	}
+}
+
+var secretErrorTests = []struct {
+	in      string
+	secrets SecretProvider
+	err     error
+}{
+	{`a = secret("x")`, nil, fmt.Errorf(errNoSecrets, "x", 1)},
+	{"a = 1\nb = secret(\"y\")", mapSecrets{}, fmt.Errorf(errSecret, "y", 2, errors.New("no such secret"))},
+	{"a = secret(\"x\")\nb = secret(\"y\")", mapSecrets{"x": "1"}, fmt.Errorf(errSecret, "y", 2, errors.New("no such secret"))},
+	{`a = secret("x")`, mapSecrets{"x": ""}, nil},
+}
+
+func TestSecretErrors(t *testing.T) {
+	for _, test := range secretErrorTests {
+		_, _, err := ReadWith([]byte(test.in), &ReadOptions{Secrets: test.secrets})
+		if !eq(err, test.err) {
+			t.Errorf("ReadWith(%q):", test.in)
+			t.Errorf("   got %v", err)
+			t.Errorf("  want %v", test.err)
+		}
+	}
+}
+
+func TestFileSecrets(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "db"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "db", "password"), []byte("hunter2\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	p := FileSecrets(dir)
+
+	if got, err := p.Secret("db/password"); got != "hunter2" || err != nil {
+		t.Errorf("Secret(%q): got %q, %v, want %q", "db/password", got, err, "hunter2")
+	}
+	if _, err := p.Secret("db/missing"); err == nil {
+		t.Errorf("Secret(%q): want an error", "db/missing")
+	}
+
+	for _, name := range []string{"../etc/passwd", "/etc/passwd", "db/../../x", ""} {
+		if _, err := p.Secret(name); !eq(err, fmt.Errorf(errSecretName, name)) {
+			t.Errorf("Secret(%q): got %v, want %v", name, err, fmt.Errorf(errSecretName, name))
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package walnut
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Counts the elements of each repeated key group seen so far, keyed by the
+// group's full key.
+type sectionCounter map[string]int
+
+// Converts the key of a line, as returned by selectKey, to its canonical
+// form. A key ending in "[]" starts a new element of a repeated key group,
+// whose last segment is given the element's index: the first "upstream[]"
+// under a group becomes "upstream[0]", the next "upstream[1]", and so on.
+// The second return value reports whether that was the case, the third
+// whether the key was well-formed.
+func (s sectionCounter) lineKey(parents []string, raw string) (string, bool, bool) {
+	raw, repeated := strings.CutSuffix(raw, "[]")
+
+	segments, ok := splitKey(raw)
+	if !ok {
+		return "", false, false
+	}
+	if !repeated {
+		return JoinKey(segments...), false, true
+	}
+
+	full := JoinKey(segments...)
+	if len(parents) > 0 {
+		full = strings.Join(parents, ".") + "." + full
+	}
+
+	last := len(segments) - 1
+	segments[last] = sectionSegment(segments[last], s[full])
+	s[full]++
+
+	return JoinKey(segments...), true, true
+}
+
+// Returns the key segment of a repeated group's element.
+func sectionSegment(name string, index int) string {
+	return name + "[" + strconv.Itoa(index) + "]"
+}
+
+// Returns the index of a repeated group's element, if the segment belongs
+// to one of the group's elements, or -1 otherwise.
+func sectionIndex(segment, name string) int {
+	if !strings.HasPrefix(segment, name+"[") || !strings.HasSuffix(segment, "]") {
+		return -1
+	}
+
+	digits := segment[len(name)+1 : len(segment)-1]
+
+	i, err := strconv.Atoi(digits)
+	if err != nil || i < 0 || strconv.Itoa(i) != digits {
+		return -1
+	}
+
+	return i
+}
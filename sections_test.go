@@ -0,0 +1,177 @@
+package walnut
+
+import (
+	"flag"
+	"fmt"
+	"testing"
+)
+
+var sectionIndexTests = []struct {
+	segment string
+	name    string
+	want    int
+}{
+	{"upstream[0]", "upstream", 0},
+	{"upstream[12]", "upstream", 12},
+	{"upstream", "upstream", -1},
+	{"upstream[]", "upstream", -1},
+	{"upstream[01]", "upstream", -1},
+	{"upstream[-1]", "upstream", -1},
+	{"upstream[+1]", "upstream", -1},
+	{"upstreams[0]", "upstream", -1},
+	{"a b[3]", "a b", 3},
+}
+
+func TestSectionIndex(t *testing.T) {
+	for _, test := range sectionIndexTests {
+		if got := sectionIndex(test.segment, test.name); got != test.want {
+			t.Errorf("sectionIndex(%q, %q):", test.segment, test.name)
+			t.Errorf("   got %d", got)
+			t.Errorf("  want %d", test.want)
+		}
+	}
+}
+
+const sectionsSource = `
+proxy
+  upstream[]
+    host = "10.0.0.1"
+    port = 80
+  upstream[]
+    host = "10.0.0.2"
+    port = 8080
+    check[]
+      path = "/health"
+    check[] = {path = "/ready"}
+  upstream[] = {host = "10.0.0.3", port = 80}
+  "main pool"[]
+    weight = 1
+cron[]
+  job = "backup"
+`
+
+func TestConfigSections(t *testing.T) {
+	conf, err := Read([]byte(sectionsSource))
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+
+	upstreams := conf.Sections("proxy.upstream")
+	if len(upstreams) != 3 {
+		t.Fatalf("Config.Sections(%q): got %d sections, want 3", "proxy.upstream", len(upstreams))
+	}
+
+	for i, want := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"} {
+		if v, _ := upstreams[i].Get("host"); v != want {
+			t.Errorf("section %d: got host %v, want %v", i, v, want)
+		}
+	}
+
+	checks := upstreams[1].Sections("check")
+	if len(checks) != 2 {
+		t.Fatalf("Config.Sections(%q): got %d sections, want 2", "check", len(checks))
+	}
+	if v, _ := checks[1].Get("path"); v != "/ready" {
+		t.Errorf("second check: got path %v, want %v", v, "/ready")
+	}
+	if got := upstreams[0].Sections("check"); len(got) != 0 {
+		t.Errorf("first upstream: got %d checks, want none", len(got))
+	}
+
+	if got := conf.Select("proxy").Sections("upstream"); len(got) != 3 {
+		t.Errorf("Select(%q).Sections(%q): got %d sections, want 3", "proxy", "upstream", len(got))
+	}
+	if got := conf.Sections(JoinKey("proxy", "main pool")); len(got) != 1 {
+		t.Errorf("Config.Sections(%q): got %d sections, want 1", JoinKey("proxy", "main pool"), len(got))
+	}
+	if got := conf.Sections("cron"); len(got) != 1 {
+		t.Errorf("Config.Sections(%q): got %d sections, want 1", "cron", len(got))
+	}
+	if got := conf.Sections("proxy"); len(got) != 0 {
+		t.Errorf("Config.Sections(%q): got %d sections, want none", "proxy", len(got))
+	}
+
+	want := []string{
+		"cron[0].job",
+		`proxy."main pool[0]".weight`,
+		"proxy.upstream[0].host",
+		"proxy.upstream[0].port",
+		"proxy.upstream[1].check[0].path",
+		"proxy.upstream[1].check[1].path",
+		"proxy.upstream[1].host",
+		"proxy.upstream[1].port",
+		"proxy.upstream[2].host",
+		"proxy.upstream[2].port",
+	}
+	if got := conf.Keys(); !eq(got, want) {
+		t.Errorf("Config.Keys():")
+		t.Errorf("   got %q", got)
+		t.Errorf("  want %q", want)
+	}
+}
+
+func TestConfigSectionsEmpty(t *testing.T) {
+	src := "up[]\nup[]\n  host = \"a\"\nup[]\n@if x\n  up[]\nup[]\n"
+
+	conf, _, err := ReadWith([]byte(src), &ReadOptions{Vars: map[string]string{}})
+	if err != nil {
+		t.Fatalf("ReadWith: %v", err)
+	}
+
+	// elements without keys still count, but not those of unselected
+	// conditional blocks
+	ups := conf.Sections("up")
+	if len(ups) != 4 {
+		t.Fatalf("Config.Sections(%q): got %d sections, want 4", "up", len(ups))
+	}
+	if v, _ := ups[1].Get("host"); v != "a" {
+		t.Errorf("second section: got host %v, want %q", v, "a")
+	}
+	if keys := ups[3].Keys(); len(keys) != 0 {
+		t.Errorf("last section: got keys %q, want none", keys)
+	}
+
+	var fs flag.FlagSet
+	if got := BindFlags(&fs, conf).Sections("up"); len(got) != 4 {
+		t.Errorf("BindFlags(...).Sections(%q): got %d sections, want 4", "up", len(got))
+	}
+}
+
+var sectionErrorTests = []struct {
+	in  string
+	err error
+}{
+	{"a[] = 1", fmt.Errorf(errKey, 1)},
+	{"a[].b = 1", fmt.Errorf(errKey, 1)},
+	{"[]\n  b = 1", fmt.Errorf(errKey, 1)},
+	{"a = {b[] = {c = 1}}", fmt.Errorf(errValue, 1, "{b[] = {c = 1}}")},
+	{"a[]\n  b = 1\na[0].b = 2", fmt.Errorf(errConflict, "a[0].b", 3, "a[0].b", 2)},
+	{"up = 3\nup[]\n  a = 1", fmt.Errorf(errRepeated, "up", 1, "up[]")},
+	{"up[]\n  a = 1\nup.b = 2", fmt.Errorf(errRepeated, "up.b", 3, "up[]")},
+	{"x\n  up[]\nx.up = {a = 1}", fmt.Errorf(errRepeated, "x.up.a", 3, "x.up[]")},
+}
+
+func TestSectionErrors(t *testing.T) {
+	for _, test := range sectionErrorTests {
+		_, err := Read([]byte(test.in))
+		if !eq(err, test.err) {
+			t.Errorf("Read(%q):", test.in)
+			t.Errorf("   got %v", err)
+			t.Errorf("  want %v", test.err)
+		}
+	}
+}
+
+func TestParseSections(t *testing.T) {
+	f, err := Parse([]byte("a[]\n  b = 1\na[]\n  b = 2\n"))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	if line := f.Lookup("a[1].b"); line == nil || line.Literal() != "2" {
+		t.Errorf("File.Lookup(%q): got %v, want the line defining b = 2", "a[1].b", line)
+	}
+	if got := string(f.Bytes()); got != "a[]\n  b = 1\na[]\n  b = 2\n" {
+		t.Errorf("File.Bytes(): got %q", got)
+	}
+}
@@ -0,0 +1,404 @@
+package walnut
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+const (
+	errNotValue  = "%q is a key group, not a value key"
+	errExists    = "%q is already defined (line %d)"
+	errInlineMap = "%q is part of the inline map on line %d, which can only be set as a whole"
+)
+
+// The different kinds of lines in a File.
+type LineKind int
+
+const (
+	BlankLine LineKind = iota
+	CommentLine
+	GroupLine
+	ValueLine
+	DirectiveLine
+)
+
+// A File is a configuration file parsed into a concrete syntax tree. Unlike
+// a Config it keeps every line, including comments, blank lines and the
+// original indentation, so that it can be edited and written back without
+// disturbing the parts that weren't changed.
+type File struct {
+	Lines []*Line
+}
+
+// A Line is a single line of a File. Lines are nested by their depth; a
+// key group's children are the deeper lines directly following it.
+type Line struct {
+	kind  LineKind
+	depth int
+	path  string
+
+	// the line's text is split into the part before the value literal,
+	// the literal, and everything after it (whitespace and comments)
+	prefix  string
+	literal string
+	suffix  string
+}
+
+// Returns the line's kind.
+func (l *Line) Kind() LineKind {
+	return l.kind
+}
+
+// Returns the line's depth, i.e. the number of key groups and conditional
+// blocks it's nested in.
+func (l *Line) Depth() int {
+	return l.depth
+}
+
+// Returns the line's leading whitespace.
+func (l *Line) Indent() string {
+	indent, _ := selectSpace(l.prefix)
+	return indent
+}
+
+// Returns the full key defined by a group or value line, including the keys
+// of any parent groups.
+func (l *Line) Key() string {
+	return l.path
+}
+
+// Returns the raw value literal of a value line, exactly as written.
+func (l *Line) Literal() string {
+	return l.literal
+}
+
+// Returns the line's comment, including the leading '#', or an empty string
+// if it has none.
+func (l *Line) Comment() string {
+	if i := strings.IndexByte(l.suffix, '#'); i >= 0 {
+		return strings.TrimRight(l.suffix[i:], "\r")
+	}
+	return ""
+}
+
+// Returns the line's text, excluding the line break.
+func (l *Line) String() string {
+	return l.prefix + l.literal + l.suffix
+}
+
+// Parses a configuration file into a File. Returns an error if the source
+// contains a syntax error; like Read, but without checking for conflicting
+// keys.
+func Parse(in []byte) (*File, error) {
+	raw := strings.Split(string(in), "\n")
+
+	f := &File{make([]*Line, 0, len(raw))}
+	indents := make([]string, 0)
+	groups := make([]string, 0)
+	sections := make(sectionCounter)
+	blocks := make([]int, 0) // the depths of the enclosing directives
+
+	for index, text := range raw {
+		index++
+
+		if isEmpty(text) {
+			kind := BlankLine
+			if strings.ContainsRune(text, '#') {
+				kind = CommentLine
+			}
+			f.Lines = append(f.Lines, &Line{kind: kind, suffix: text})
+			continue
+		}
+
+		indent, content := selectSpace(text)
+
+		depth, ok := indentLevel(indents, indent)
+		if !ok {
+			return nil, fmt.Errorf(errIndent, index)
+		}
+		indents = append(indents[:depth], indent)
+
+		for len(blocks) > 0 && blocks[len(blocks)-1] >= depth {
+			blocks = blocks[:len(blocks)-1]
+		}
+
+		if directive, arg := selectDirective(content); directive != "" {
+			if _, ok := parseCondition(arg); !ok && directive != "@else" || directive == "@else" && !isEmpty(arg) {
+				return nil, fmt.Errorf(errDirective, index)
+			}
+
+			blocks = append(blocks, depth)
+			f.Lines = append(f.Lines, &Line{kind: DirectiveLine, depth: depth, prefix: text})
+			continue
+		}
+
+		// keys within conditional blocks are defined as if they weren't
+		// nested in them
+		level := depth - len(blocks)
+
+		key, rest := selectKey(content)
+
+		name, repeated, ok := sections.lineKey(groups[:level], key)
+		if !ok {
+			return nil, fmt.Errorf(errKey, index)
+		}
+
+		groups = append(groups[:level], name)
+		path := strings.Join(groups, ".")
+
+		if isEmpty(rest) {
+			f.Lines = append(f.Lines, &Line{
+				kind:   GroupLine,
+				depth:  depth,
+				path:   path,
+				prefix: indent + key,
+				suffix: rest,
+			})
+			continue
+		}
+
+		value, ok := consumeSeparator(rest)
+		if !ok && !isEmpty(value) {
+			return nil, fmt.Errorf(errKey, index)
+		}
+
+		_, n := readLiteral(value)
+		if _, m := readInlineMap(value); m > 0 && isEmpty(value[m:]) {
+			n = m
+		} else if repeated {
+			return nil, fmt.Errorf(errKey, index)
+		}
+		if n == 0 {
+			return nil, literalError(index, value)
+		}
+
+		split := len(text) - len(value)
+		f.Lines = append(f.Lines, &Line{
+			kind:    ValueLine,
+			depth:   depth,
+			path:    path,
+			prefix:  text[:split],
+			literal: value[:n],
+			suffix:  value[n:],
+		})
+	}
+
+	return f, nil
+}
+
+// Returns the file's contents. Lines which haven't been modified are
+// reproduced exactly as they were parsed.
+func (f *File) Bytes() []byte {
+	lines := make([]string, len(f.Lines))
+	for i, line := range f.Lines {
+		lines[i] = line.String()
+	}
+
+	return []byte(strings.Join(lines, "\n"))
+}
+
+// Parses the file's current contents as a Config. Files using conditional
+// blocks, overrides or secret references need ConfigWith instead.
+func (f *File) Config() (Config, error) {
+	conf, _, err := f.ConfigWith(nil)
+	return conf, err
+}
+
+// Like Config, but with options, as for ReadWith.
+func (f *File) ConfigWith(opts *ReadOptions) (Config, []Warning, error) {
+	return ReadWith(f.Bytes(), opts)
+}
+
+// Returns the line defining a key, or nil if the key isn't defined. Entries
+// of inline maps have no line of their own, so they aren't found either;
+// look up the map's key instead.
+func (f *File) Lookup(key string) *Line {
+	if i := f.find(key); i >= 0 {
+		return f.Lines[i]
+	}
+	return nil
+}
+
+// Sets the value of a key. If the key already has a value, only the value
+// literal is replaced, leaving indentation and comments untouched.
+// Otherwise the key is added, as by Add. Entries of inline maps, e.g. the
+// read in "limits = {read = 10}", can't be set individually, and neither
+// added nor deleted.
+func (f *File) Set(key string, value interface{}) error {
+	literal, err := formatValue(key, value)
+	if err != nil {
+		return err
+	}
+
+	i := f.find(key)
+	if i < 0 {
+		return f.Add(key, value)
+	}
+
+	line := f.Lines[i]
+	if line.kind != ValueLine {
+		return fmt.Errorf(errNotValue, key)
+	}
+
+	line.literal = literal
+	return nil
+}
+
+// Adds a key and its value. The key is placed at the end of its innermost
+// existing key group, indented like its siblings, or at the end of the file
+// if no such group exists. Returns an error if the key is already defined,
+// or collides with another key.
+func (f *File) Add(key string, value interface{}) error {
+	literal, err := formatValue(key, value)
+	if err != nil {
+		return err
+	}
+
+	// find the innermost group containing the key, while checking for
+	// collisions with existing keys
+	parent := -1
+
+	for i, line := range f.Lines {
+		switch {
+		case line.kind != GroupLine && line.kind != ValueLine:
+			continue
+		case line.isInlineMap() && conflicts(key, line.path) && key != line.path:
+			return fmt.Errorf(errInlineMap, key, i+1)
+		case line.kind == GroupLine && conflicts(key, line.path) && key != line.path:
+			if parent < 0 || line.depth > f.Lines[parent].depth {
+				parent = i
+			}
+		case conflicts(key, line.path) || conflicts(line.path, key):
+			return fmt.Errorf(errExists, key, i+1)
+		}
+	}
+
+	name := key
+	depth := 0
+	indent := ""
+	at := len(f.Lines)
+
+	if parent >= 0 {
+		group := f.Lines[parent]
+		name = key[len(group.path)+1:]
+		depth = group.depth + 1
+		at = parent + 1
+
+		// indent like the group's first child, if it has one
+		indent = group.Indent() + "  "
+		if strings.HasPrefix(group.Indent(), "\t") {
+			indent = group.Indent() + "\t"
+		}
+
+		for i := parent + 1; i < len(f.Lines); i++ {
+			line := f.Lines[i]
+			if line.kind == BlankLine || line.kind == CommentLine {
+				continue
+			}
+			if line.depth <= group.depth {
+				break
+			}
+			if at == parent+1 {
+				indent = line.Indent()
+			}
+			at = i + 1
+		}
+	} else {
+		// skip past trailing blank lines
+		for at > 0 && f.Lines[at-1].kind == BlankLine {
+			at--
+		}
+	}
+
+	line := &Line{
+		kind:    ValueLine,
+		depth:   depth,
+		path:    key,
+		prefix:  indent + name + " = ",
+		literal: literal,
+	}
+
+	// make sure the file ends with a line break
+	if at == len(f.Lines) {
+		f.Lines = append(f.Lines, line, &Line{kind: BlankLine})
+		return nil
+	}
+
+	f.Lines = append(f.Lines, nil)
+	copy(f.Lines[at+1:], f.Lines[at:])
+	f.Lines[at] = line
+
+	return nil
+}
+
+// Deletes a key. If the key is a key group, all of its children are deleted
+// along with it. Comments and blank lines between deleted keys are deleted
+// as well; all other lines are left in place.
+func (f *File) Delete(key string) error {
+	lines := make([]*Line, 0, len(f.Lines))
+	deleted := false
+
+	for i := 0; i < len(f.Lines); i++ {
+		line := f.Lines[i]
+		if line.kind != GroupLine && line.kind != ValueLine || !conflicts(line.path, key) {
+			lines = append(lines, line)
+			continue
+		}
+
+		// skip the line's children, but not any trailing comments and
+		// blank lines
+		end := i + 1
+		for j := i + 1; j < len(f.Lines); j++ {
+			child := f.Lines[j]
+			if child.kind == BlankLine || child.kind == CommentLine {
+				continue
+			}
+			if child.depth <= line.depth {
+				break
+			}
+			end = j + 1
+		}
+
+		deleted = true
+		i = end - 1
+	}
+
+	if !deleted {
+		for i, line := range f.Lines {
+			if line.isInlineMap() && conflicts(key, line.path) {
+				return fmt.Errorf(errInlineMap, key, i+1)
+			}
+		}
+		return fmt.Errorf(errUndefined, key)
+	}
+
+	f.Lines = lines
+	return nil
+}
+
+// Returns the index of the line defining a key, or -1.
+func (f *File) find(key string) int {
+	for i, line := range f.Lines {
+		if (line.kind == GroupLine || line.kind == ValueLine) && line.path == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// Returns true if the line assigns an inline map.
+func (l *Line) isInlineMap() bool {
+	_, n := readInlineMap(l.literal)
+	return l.kind == ValueLine && n > 0
+}
+
+// Formats a value for assignment to a key.
+func formatValue(key string, value interface{}) (string, error) {
+	literal, ok := formatLiteral(value)
+	if !ok {
+		typ := reflect.TypeOf(value).String()
+		return "", fmt.Errorf(errWrongType, key, typ, "a walnut type")
+	}
+	return literal, nil
+}
@@ -0,0 +1,279 @@
+package walnut
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+var sampleFile = `# application configuration file
+
+http
+    host = "localhost"   # where to listen
+    port = 8080
+
+    # timeouts
+    timeout
+        read = 10s
+        write = 20s
+
+cookie.ttl = 48h 30m
+`
+
+var parseTests = []string{
+	"",
+	"\n\n",
+	"a = 1",
+	"a=1\r\nb\t=\t\"#\"  # comment\r\n",
+	"# only a comment",
+	"limits = { read = 10,write=5 }  # per second",
+	sampleFile,
+}
+
+func TestParse(t *testing.T) {
+	for _, in := range parseTests {
+		f, err := Parse([]byte(in))
+		if err != nil || string(f.Bytes()) != in {
+			t.Errorf("Parse(%q).Bytes():", in)
+			t.Errorf("   got %q, %v", f.Bytes(), err)
+			t.Errorf("  want %q, %v", in, nil)
+		}
+	}
+}
+
+var parseErrorTests = []struct {
+	in  string
+	err error
+}{
+	{" a = 1", fmt.Errorf(errIndent, 1)},
+	{"a\n  b = 1\n c = 2", fmt.Errorf(errIndent, 3)},
+	{"a b = 1", fmt.Errorf(errKey, 1)},
+	{"a.\"b = 1", fmt.Errorf(errKey, 1)},
+	{"a = 0 0", fmt.Errorf(errValue, 1, "0 0")},
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, test := range parseErrorTests {
+		_, err := Parse([]byte(test.in))
+		if !eq(err, test.err) {
+			t.Errorf("Parse(%q):", test.in)
+			t.Errorf("   got %v", err)
+			t.Errorf("  want %v", test.err)
+		}
+	}
+}
+
+func TestFileLines(t *testing.T) {
+	f, _ := Parse([]byte(sampleFile))
+
+	want := []struct {
+		kind    LineKind
+		depth   int
+		key     string
+		literal string
+		comment string
+	}{
+		{CommentLine, 0, "", "", "# application configuration file"},
+		{BlankLine, 0, "", "", ""},
+		{GroupLine, 0, "http", "", ""},
+		{ValueLine, 1, "http.host", `"localhost"`, "# where to listen"},
+		{ValueLine, 1, "http.port", "8080", ""},
+		{BlankLine, 0, "", "", ""},
+		{CommentLine, 0, "", "", "# timeouts"},
+		{GroupLine, 1, "http.timeout", "", ""},
+		{ValueLine, 2, "http.timeout.read", "10s", ""},
+		{ValueLine, 2, "http.timeout.write", "20s", ""},
+		{BlankLine, 0, "", "", ""},
+		{ValueLine, 0, "cookie.ttl", "48h 30m", ""},
+		{BlankLine, 0, "", "", ""},
+	}
+
+	if len(f.Lines) != len(want) {
+		t.Fatalf("Parse(sampleFile) has %d lines, want %d", len(f.Lines), len(want))
+	}
+
+	for i, w := range want {
+		l := f.Lines[i]
+		if l.Kind() != w.kind || l.Depth() != w.depth || l.Key() != w.key ||
+			l.Literal() != w.literal || l.Comment() != w.comment {
+			t.Errorf("line %d:", i+1)
+			t.Errorf("   got %v, %d, %q, %q, %q", l.Kind(), l.Depth(), l.Key(), l.Literal(), l.Comment())
+			t.Errorf("  want %v, %d, %q, %q, %q", w.kind, w.depth, w.key, w.literal, w.comment)
+		}
+	}
+}
+
+var editTests = []struct {
+	edit func(f *File) error
+	want string
+	err  error
+}{
+	{
+		func(f *File) error { return f.Set("http.port", int64(9090)) },
+		"http\n    host = \"localhost\"   # where to listen\n    port = 9090\n",
+		nil,
+	},
+	{
+		func(f *File) error { return f.Set("http.host", "example.com") },
+		"http\n    host = \"example.com\"   # where to listen\n    port = 8080\n",
+		nil,
+	},
+	{
+		func(f *File) error { return f.Set("http.tls", true) },
+		"http\n    host = \"localhost\"   # where to listen\n    port = 8080\n    tls = true\n",
+		nil,
+	},
+	{
+		func(f *File) error { return f.Add("http.timeout.read", 5*time.Second) },
+		"http\n    host = \"localhost\"   # where to listen\n    port = 8080\n    timeout.read = 5s\n",
+		nil,
+	},
+	{
+		func(f *File) error { return f.Add("debug", false) },
+		"http\n    host = \"localhost\"   # where to listen\n    port = 8080\ndebug = false\n",
+		nil,
+	},
+	{
+		func(f *File) error { return f.Delete("http.host") },
+		"http\n    port = 8080\n",
+		nil,
+	},
+	{
+		func(f *File) error { return f.Delete("http") },
+		"",
+		nil,
+	},
+	{
+		func(f *File) error { return f.Add("http.port", int64(1)) },
+		"",
+		fmt.Errorf(errExists, "http.port", 3),
+	},
+	{
+		func(f *File) error { return f.Add("http.port.x", int64(1)) },
+		"",
+		fmt.Errorf(errExists, "http.port.x", 3),
+	},
+	{
+		func(f *File) error { return f.Set("http", int64(1)) },
+		"",
+		fmt.Errorf(errNotValue, "http"),
+	},
+	{
+		func(f *File) error { return f.Delete("nope") },
+		"",
+		fmt.Errorf(errUndefined, "nope"),
+	},
+	{
+		func(f *File) error { return f.Set("x", []int{}) },
+		"",
+		fmt.Errorf(errWrongType, "x", "[]int", "a walnut type"),
+	},
+}
+
+func TestFileEditInlineMap(t *testing.T) {
+	in := "http\n  limits = {read = 1}\n"
+
+	edits := map[string]func(f *File) error{
+		"Set":    func(f *File) error { return f.Set("http.limits.read", int64(5)) },
+		"Add":    func(f *File) error { return f.Add("http.limits.write", int64(5)) },
+		"Delete": func(f *File) error { return f.Delete("http.limits.read") },
+	}
+
+	for name, edit := range edits {
+		f, _ := Parse([]byte(in))
+
+		want := fmt.Errorf(errInlineMap, "http.limits.read", 2)
+		if name == "Add" {
+			want = fmt.Errorf(errInlineMap, "http.limits.write", 2)
+		}
+
+		if err := edit(f); !eq(err, want) || string(f.Bytes()) != in {
+			t.Errorf("File.%s on %q:", name, in)
+			t.Errorf("   got %q, %v", f.Bytes(), err)
+			t.Errorf("  want %q, %v", in, want)
+		}
+	}
+
+	f, _ := Parse([]byte(in))
+	if line := f.Lookup("http.limits"); line == nil || line.Literal() != "{read = 1}" {
+		t.Errorf("File.Lookup(%q): got %v", "http.limits", line)
+	}
+	if err := f.Delete("http.limits"); err != nil || string(f.Bytes()) != "http\n" {
+		t.Errorf("File.Delete(%q): got %q, %v", "http.limits", f.Bytes(), err)
+	}
+}
+
+func TestFileConfigWith(t *testing.T) {
+	f, err := Parse([]byte("@if env == \"prod\"\n  port = 80\n@else\n  port = 8080\n"))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	if _, err := f.Config(); !eq(err, fmt.Errorf(errVariable, "env", 1)) {
+		t.Errorf("File.Config(): got %v, want an undefined variable", err)
+	}
+
+	conf, _, err := f.ConfigWith(&ReadOptions{Vars: map[string]string{"env": "prod"}})
+	if err != nil {
+		t.Fatalf("File.ConfigWith: %v", err)
+	}
+	if got := conf.Int64("port"); got != 80 {
+		t.Errorf("File.ConfigWith(...).Int64(%q): got %d, want 80", "port", got)
+	}
+}
+
+func TestFileEdit(t *testing.T) {
+	in := "http\n    host = \"localhost\"   # where to listen\n    port = 8080\n"
+
+	for _, test := range editTests {
+		f, _ := Parse([]byte(in))
+
+		err := test.edit(f)
+		if err != nil && eq(err, test.err) {
+			continue
+		}
+
+		if got := string(f.Bytes()); got != test.want || !eq(err, test.err) {
+			t.Errorf("editing %q:", in)
+			t.Errorf("   got %q, %v", got, err)
+			t.Errorf("  want %q, %v", test.want, test.err)
+		}
+	}
+}
+
+func TestFileEditPreservesLayout(t *testing.T) {
+	f, _ := Parse([]byte(sampleFile))
+
+	f.Set("http.timeout.write", 30*time.Second)
+	f.Add("http.timeout.idle", 2*time.Minute)
+	f.Delete("cookie")
+
+	want := `# application configuration file
+
+http
+    host = "localhost"   # where to listen
+    port = 8080
+
+    # timeouts
+    timeout
+        read = 10s
+        write = 30s
+        idle = 2m
+
+`
+
+	if got := string(f.Bytes()); got != want {
+		t.Errorf("edited sampleFile:")
+		t.Errorf("   got %q", got)
+		t.Errorf("  want %q", want)
+	}
+
+	conf, err := f.Config()
+	if err != nil {
+		t.Fatalf("File.Config(): %v", err)
+	}
+
+	if got := conf.Duration("http.timeout.idle"); got != 2*time.Minute {
+		t.Errorf("File.Config().Duration(\"http.timeout.idle\") = %v, want 2m", got)
+	}
+}
@@ -0,0 +1,808 @@
+package walnut
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"net/netip"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	errTOMLSyntax    = "TOML syntax error on line %d: %s"
+	errTOMLDuplicate = "TOML key %q defined twice"
+)
+
+var (
+	reTOMLBareKey   = regexp.MustCompile(`^[A-Za-z0-9_\-]+$`)
+	reTOMLDate      = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`)
+	reTOMLTime      = regexp.MustCompile(`^\d{2}:\d{2}:\d{2}(?:\.\d+)?$`)
+	reTOMLLocalDate = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}[Tt ]\d{2}:\d{2}:\d{2}(?:\.\d+)?$`)
+)
+
+// Converts a TOML document to walnut source. Tables become key groups and
+// inline tables are expanded in the same way. Strings holding durations,
+// timestamps and the like are converted like in FromJSON.
+//
+// Arrays (including arrays of tables) have no walnut equivalent and are
+// skipped, and local date-times are assumed to be in UTC. Each such loss is
+// reported as a Warning. Local dates and times become walnut dates and times
+// of day.
+func FromTOML(in []byte) ([]byte, []Warning, error) {
+	p := &tomlParser{src: string(in), line: 1}
+
+	values, err := p.parse()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	table := make(map[string]string)
+	warnings := p.warnings
+
+	for _, v := range values {
+		literal, warning := tomlLiteral(v.value)
+		if warning != "" {
+			warnings = append(warnings, Warning{v.key, warning})
+		}
+		if literal != "" {
+			table[v.key] = literal
+		}
+	}
+
+	out, err := writeTable(table)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return out, warnings, nil
+}
+
+// Converts a value parsed from a TOML document to a walnut literal. Returns
+// an empty literal if the value is dropped, and a non-empty warning if the
+// conversion wasn't lossless.
+func tomlLiteral(v interface{}) (string, string) {
+	switch v := v.(type) {
+	case bool, int64, time.Time:
+		literal, _ := formatLiteral(v)
+		return literal, ""
+	case float64:
+		return formatFloat64(v), ""
+	case string:
+		return stringLiteral(v), ""
+	case tomlLocal:
+		if d, n := readDate(string(v)); n > 0 && n == len(v) {
+			return d.String(), ""
+		}
+		if t, n := readTimeOfDay(string(v)); n > 0 && n == len(v) {
+			return t.String(), ""
+		}
+		if t, err := time.Parse("2006-01-02T15:04:05.999999999", v.String()); err == nil {
+			literal, _ := formatTime(t)
+			return literal, "local date-time converted assuming UTC"
+		}
+		return strconv.Quote(v.String()), "local date or time converted to a string"
+	case []interface{}:
+		return "", "arrays cannot be represented in walnut"
+	}
+
+	return "", fmt.Sprintf("unsupported TOML value %v", v)
+}
+
+// A local date, time, or date-time. Walnut has dates and times of day, but
+// no local date-times.
+type tomlLocal string
+
+// Returns the value with a 'T' separating date and time, as expected by
+// time.Parse.
+func (l tomlLocal) String() string {
+	return strings.Replace(strings.ToUpper(string(l)), " ", "T", 1)
+}
+
+type tomlValue struct {
+	key   string
+	value interface{}
+}
+
+// A minimal TOML parser, producing a flat list of (key, value) pairs.
+type tomlParser struct {
+	src      string
+	pos      int
+	line     int
+	warnings []Warning
+}
+
+func (p *tomlParser) parse() ([]tomlValue, error) {
+	values := make([]tomlValue, 0)
+	defined := make(map[string]bool)
+	tables := make(map[string]bool)
+	arrays := make([]string, 0)
+	table := ""
+	array := false
+
+	for {
+		p.skip(true)
+		if p.pos == len(p.src) {
+			break
+		}
+
+		if p.peek("[") {
+			array = p.peek("[[")
+			if array {
+				p.pos += 2
+			} else {
+				p.pos++
+			}
+
+			key, err := p.key()
+			if err != nil {
+				return nil, err
+			}
+
+			if array {
+				if !p.peek("]]") {
+					return nil, p.errorf("expected ]]")
+				}
+				p.pos += 2
+
+				if !defined[key] {
+					defined[key] = true
+					arrays = append(arrays, key)
+					p.warnings = append(p.warnings, Warning{key,
+						"arrays of tables cannot be represented in walnut"})
+				}
+			} else {
+				if !p.peek("]") {
+					return nil, p.errorf("expected ]")
+				}
+				p.pos++
+
+				// a table can't be opened twice, nor redefine a value
+				if tables[key] || defined[key] {
+					return nil, fmt.Errorf(errTOMLDuplicate, key)
+				}
+				tables[key] = true
+
+				// sub-tables of arrays of tables are skipped as well
+				for _, prefix := range arrays {
+					if conflicts(key, prefix) {
+						array = true
+					}
+				}
+			}
+
+			table = key
+			if err := p.eol(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		key, v, err := p.pair()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.eol(); err != nil {
+			return nil, err
+		}
+
+		// silently skip the contents of arrays of tables, as they've
+		// already been warned about
+		if array {
+			continue
+		}
+
+		if table != "" {
+			key = table + "." + key
+		}
+
+		flat := make([]tomlValue, 0)
+		flattenTOML(&flat, key, v)
+
+		for _, v := range flat {
+			if defined[v.key] {
+				return nil, fmt.Errorf(errTOMLDuplicate, v.key)
+			}
+			defined[v.key] = true
+			values = append(values, v)
+		}
+	}
+
+	return values, nil
+}
+
+// Expands inline tables into dotted keys.
+func flattenTOML(out *[]tomlValue, key string, v interface{}) {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		*out = append(*out, tomlValue{key, v})
+		return
+	}
+
+	for name, v := range m {
+		flattenTOML(out, key+"."+name, v)
+	}
+}
+
+// Parses a "key = value" pair.
+func (p *tomlParser) pair() (string, interface{}, error) {
+	key, err := p.key()
+	if err != nil {
+		return "", nil, err
+	}
+
+	p.skip(false)
+	if !p.peek("=") {
+		return "", nil, p.errorf("expected =")
+	}
+	p.pos++
+	p.skip(false)
+
+	v, err := p.value()
+	if err != nil {
+		return "", nil, err
+	}
+
+	return key, v, nil
+}
+
+// Parses a (possibly dotted) key, made up of bare or quoted segments.
+func (p *tomlParser) key() (string, error) {
+	parts := make([]string, 0)
+
+	for {
+		p.skip(false)
+
+		var part string
+		var err error
+
+		switch {
+		case p.peek(`"`):
+			part, err = p.basicString()
+		case p.peek(`'`):
+			part, err = p.literalString()
+		default:
+			s := p.pos
+			for p.pos < len(p.src) && isTOMLBare(p.src[p.pos]) {
+				p.pos++
+			}
+			part = p.src[s:p.pos]
+			if part == "" {
+				err = p.errorf("expected key")
+			}
+		}
+
+		if err != nil {
+			return "", err
+		}
+
+		parts = append(parts, part)
+
+		p.skip(false)
+		if !p.peek(".") {
+			return JoinKey(parts...), nil
+		}
+		p.pos++
+	}
+}
+
+// Parses any TOML value.
+func (p *tomlParser) value() (interface{}, error) {
+	switch {
+	case p.peek(`"`):
+		return p.basicString()
+	case p.peek(`'`):
+		return p.literalString()
+	case p.peek("["):
+		return p.array()
+	case p.peek("{"):
+		return p.inlineTable()
+	case p.peek("true"):
+		p.pos += 4
+		return true, nil
+	case p.peek("false"):
+		p.pos += 5
+		return false, nil
+	}
+
+	// what remains are numbers and dates, which we read as a single token
+	s := p.pos
+	for p.pos < len(p.src) && strings.IndexByte("0123456789abcdefABCDEFinxoTtZz_:.+-", p.src[p.pos]) >= 0 {
+		p.pos++
+	}
+
+	// dates and times may be separated by a space rather than a 'T'
+	if reTOMLDate.MatchString(p.src[s:p.pos]) && len(p.src) > p.pos+3 &&
+		p.src[p.pos] == ' ' && p.src[p.pos+3] == ':' {
+		p.pos++
+		for p.pos < len(p.src) && strings.IndexByte("0123456789Zz:.+-", p.src[p.pos]) >= 0 {
+			p.pos++
+		}
+	}
+
+	token := p.src[s:p.pos]
+
+	switch {
+	case token == "":
+		return nil, p.errorf("expected value")
+	case reTOMLDate.MatchString(token), reTOMLTime.MatchString(token),
+		reTOMLLocalDate.MatchString(token):
+		return tomlLocal(token), nil
+	}
+
+	if t, err := time.Parse(time.RFC3339Nano, tomlLocal(token).String()); err == nil {
+		return t, nil
+	}
+
+	switch strings.TrimLeft(token, "+-") {
+	case "inf":
+		if token[0] == '-' {
+			return math.Inf(-1), nil
+		}
+		return math.Inf(1), nil
+	case "nan":
+		return math.NaN(), nil
+	}
+
+	if strings.HasPrefix(token, "_") || strings.HasSuffix(token, "_") ||
+		strings.Contains(token, "__") {
+		return nil, p.errorf("invalid number " + token)
+	}
+
+	digits := strings.Replace(token, "_", "", -1)
+
+	base := 10
+	switch {
+	case strings.HasPrefix(digits, "0x"):
+		base = 16
+	case strings.HasPrefix(digits, "0o"):
+		base = 8
+	case strings.HasPrefix(digits, "0b"):
+		base = 2
+	}
+
+	// hexadecimal, octal and binary integers are unsigned
+	if base != 10 {
+		rest := digits[2:]
+		if v, err := strconv.ParseInt(rest, base, 64); err == nil && !strings.ContainsAny(rest, "+-") {
+			return v, nil
+		}
+		return nil, p.errorf("invalid number " + token)
+	}
+
+	// decimal numbers can't have leading zeros, which Go would read as
+	// octal
+	whole := strings.TrimLeft(digits, "+-")
+	if i := strings.IndexAny(whole, ".eE"); i >= 0 {
+		whole = whole[:i]
+	}
+	if len(whole) > 1 && whole[0] == '0' {
+		return nil, p.errorf("invalid number " + token)
+	}
+
+	if v, err := strconv.ParseInt(digits, 10, 64); err == nil {
+		return v, nil
+	}
+	if v, err := strconv.ParseFloat(digits, 64); err == nil {
+		return v, nil
+	}
+
+	return nil, p.errorf("invalid value " + token)
+}
+
+// Parses a basic (double-quoted) string, either single- or multi-line.
+func (p *tomlParser) basicString() (string, error) {
+	multi := p.peek(`"""`)
+	if multi {
+		p.pos += 3
+		// a newline immediately following the delimiter is trimmed
+		p.newline()
+	} else {
+		p.pos++
+	}
+
+	var buf bytes.Buffer
+
+	for {
+		if p.pos == len(p.src) {
+			return "", p.errorf("unterminated string")
+		}
+
+		switch b := p.src[p.pos]; {
+		case multi && p.peek(`"""`):
+			p.pos += 3
+			return buf.String(), nil
+		case !multi && b == '"':
+			p.pos++
+			return buf.String(), nil
+		case b == '\n' && !multi:
+			return "", p.errorf("unterminated string")
+		case b == '\n':
+			p.line++
+			buf.WriteByte(b)
+			p.pos++
+		case b == '\\':
+			if err := p.escape(&buf, multi); err != nil {
+				return "", err
+			}
+		default:
+			buf.WriteByte(b)
+			p.pos++
+		}
+	}
+}
+
+// Parses a backslash escape sequence inside a basic string.
+func (p *tomlParser) escape(buf *bytes.Buffer, multi bool) error {
+	p.pos++
+	if p.pos == len(p.src) {
+		return p.errorf("unterminated string")
+	}
+
+	b := p.src[p.pos]
+	p.pos++
+
+	switch b {
+	case 'b':
+		buf.WriteByte('\b')
+	case 't':
+		buf.WriteByte('\t')
+	case 'n':
+		buf.WriteByte('\n')
+	case 'f':
+		buf.WriteByte('\f')
+	case 'r':
+		buf.WriteByte('\r')
+	case 'e':
+		buf.WriteByte(0x1b)
+	case '"', '\\':
+		buf.WriteByte(b)
+	case 'u', 'U':
+		n := 4
+		if b == 'U' {
+			n = 8
+		}
+		if p.pos+n > len(p.src) {
+			return p.errorf("invalid escape sequence")
+		}
+		r, err := strconv.ParseUint(p.src[p.pos:p.pos+n], 16, 32)
+		if err != nil || !utf8.ValidRune(rune(r)) {
+			return p.errorf("invalid escape sequence")
+		}
+		buf.WriteRune(rune(r))
+		p.pos += n
+	default:
+		// a line ending backslash trims all following whitespace
+		if !multi || !strings.ContainsRune(" \t\r\n", rune(b)) {
+			return p.errorf("invalid escape sequence")
+		}
+		p.pos--
+		for p.pos < len(p.src) && strings.ContainsRune(" \t\r\n", rune(p.src[p.pos])) {
+			if p.src[p.pos] == '\n' {
+				p.line++
+			}
+			p.pos++
+		}
+	}
+
+	return nil
+}
+
+// Parses a literal (single-quoted) string, either single- or multi-line.
+func (p *tomlParser) literalString() (string, error) {
+	delim := "'"
+	if p.peek("'''") {
+		delim = "'''"
+	}
+	p.pos += len(delim)
+
+	if delim == "'''" {
+		p.newline()
+	}
+
+	end := strings.Index(p.src[p.pos:], delim)
+	if end < 0 {
+		return "", p.errorf("unterminated string")
+	}
+
+	s := p.src[p.pos : p.pos+end]
+	if delim == "'" && strings.Contains(s, "\n") {
+		return "", p.errorf("unterminated string")
+	}
+
+	p.line += strings.Count(s, "\n")
+	p.pos += end + len(delim)
+
+	return s, nil
+}
+
+// Parses an array. Arrays may span multiple lines.
+func (p *tomlParser) array() (interface{}, error) {
+	p.pos++
+	list := make([]interface{}, 0)
+
+	for {
+		p.skip(true)
+		if p.peek("]") {
+			p.pos++
+			return list, nil
+		}
+
+		v, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, v)
+
+		p.skip(true)
+		if p.peek(",") {
+			p.pos++
+		} else if !p.peek("]") {
+			return nil, p.errorf("expected , or ]")
+		}
+	}
+}
+
+// Parses an inline table. Inline tables must appear on a single line.
+func (p *tomlParser) inlineTable() (interface{}, error) {
+	p.pos++
+	m := make(map[string]interface{})
+
+	for {
+		p.skip(false)
+		if p.peek("}") && len(m) == 0 {
+			p.pos++
+			return m, nil
+		}
+
+		key, v, err := p.pair()
+		if err != nil {
+			return nil, err
+		}
+
+		flat := make([]tomlValue, 0)
+		flattenTOML(&flat, key, v)
+		for _, v := range flat {
+			if _, ok := m[v.key]; ok {
+				return nil, fmt.Errorf(errTOMLDuplicate, v.key)
+			}
+			m[v.key] = v.value
+		}
+
+		p.skip(false)
+		switch {
+		case p.peek(","):
+			p.pos++
+		case p.peek("}"):
+			p.pos++
+			return m, nil
+		default:
+			return nil, p.errorf("expected , or }")
+		}
+	}
+}
+
+// Skips whitespace and comments. Newlines are skipped as well if multi is
+// true.
+func (p *tomlParser) skip(multi bool) {
+	for p.pos < len(p.src) {
+		switch b := p.src[p.pos]; {
+		case b == ' ' || b == '\t':
+			p.pos++
+		case b == '#':
+			for p.pos < len(p.src) && p.src[p.pos] != '\n' {
+				p.pos++
+			}
+		case multi && (b == '\n' || p.peek("\r\n")):
+			p.newline()
+		default:
+			return
+		}
+	}
+}
+
+// Consumes the end of a line, including any trailing comment.
+func (p *tomlParser) eol() error {
+	p.skip(false)
+	if p.pos < len(p.src) && !p.newline() {
+		return p.errorf("expected end of line")
+	}
+	return nil
+}
+
+// Consumes a single line break, if present.
+func (p *tomlParser) newline() bool {
+	switch {
+	case p.peek("\r\n"):
+		p.pos += 2
+	case p.peek("\n"):
+		p.pos++
+	default:
+		return false
+	}
+
+	p.line++
+	return true
+}
+
+func isTOMLBare(b byte) bool {
+	return 'a' <= b && b <= 'z' || 'A' <= b && b <= 'Z' ||
+		'0' <= b && b <= '9' || b == '_' || b == '-'
+}
+
+func (p *tomlParser) peek(s string) bool {
+	return strings.HasPrefix(p.src[p.pos:], s)
+}
+
+func (p *tomlParser) errorf(msg string) error {
+	return fmt.Errorf(errTOMLSyntax, p.line, msg)
+}
+
+// Encodes a Config as a TOML document. Key groups become tables.
+//
+// TOML has no notion of durations, periods or byte sizes, so these are
+// written as strings holding their walnut literals, which FromTOML converts
+// back. Every such value is reported as a Warning, as are nulls and values of
+// types TOML cannot represent. Timestamps in a named zone are written with
+// the zone's offset, also with a Warning. So are strings which FromTOML
+// would convert in the same way, e.g. "5s".
+func ToTOML(conf Config) ([]byte, []Warning, error) {
+	var buf bytes.Buffer
+	warnings := make([]Warning, 0)
+	keys := conf.Keys()
+
+	for _, group := range parentGroups(keys) {
+		if group != "" {
+			if buf.Len() > 0 {
+				buf.WriteByte('\n')
+			}
+			fmt.Fprintf(&buf, "[%s]\n", tomlKey(group))
+		}
+
+		for _, name := range groupKeys(keys, group) {
+			key := name
+			if group != "" {
+				key = group + "." + name
+			}
+
+			v, _ := conf.Get(key)
+
+			literal, warning := formatTOML(v)
+			if warning != "" {
+				warnings = append(warnings, Warning{key, warning})
+			}
+			if literal != "" {
+				fmt.Fprintf(&buf, "%s = %s\n", tomlKey(name), literal)
+			}
+		}
+	}
+
+	return buf.Bytes(), warnings, nil
+}
+
+// Formats a value as a TOML literal. Returns an empty literal if the value
+// can't be represented, and a non-empty warning if the conversion wasn't
+// lossless.
+func formatTOML(v interface{}) (string, string) {
+	switch v := v.(type) {
+	case Null:
+		return "", "nulls cannot be represented in TOML"
+	case bool, int64:
+		literal, _ := formatLiteral(v)
+		return literal, ""
+	case float64:
+		switch {
+		case math.IsNaN(v):
+			return "nan", ""
+		case math.IsInf(v, 1):
+			return "inf", ""
+		case math.IsInf(v, -1):
+			return "-inf", ""
+		}
+		return formatFloat64(v), ""
+	case string:
+		literal, ok := tomlQuote(v)
+		if !ok {
+			return literal, "invalid UTF-8 replaced"
+		}
+		// FromTOML reads e.g. "5s" as a duration
+		if stringLiteral(v) != strconv.Quote(v) {
+			return literal, "string would be read back as another type"
+		}
+		return literal, ""
+	case time.Time:
+		if name := zoneName(v); name != "" {
+			return v.Format(time.RFC3339Nano), "zone " + name + " converted to an offset"
+		}
+		return v.Format(time.RFC3339Nano), ""
+	case Date:
+		return v.String(), ""
+	case TimeOfDay:
+		return v.String(), ""
+	case time.Duration:
+		literal := formatDuration(v)
+		quoted, _ := tomlQuote(literal)
+		return quoted, "duration converted to a string"
+	case Period:
+		quoted, _ := tomlQuote(v.String())
+		return quoted, "period converted to a string"
+	case ByteSize:
+		quoted, _ := tomlQuote(v.String())
+		return quoted, "byte size converted to a string"
+	case netip.Addr, netip.Prefix, netip.AddrPort:
+		if literal, ok := formatLiteral(v); ok {
+			quoted, _ := tomlQuote(literal)
+			return quoted, "address converted to a string"
+		}
+	case *url.URL:
+		if literal, ok := formatURL(v); ok {
+			quoted, _ := tomlQuote(literal)
+			return quoted, "URL converted to a string"
+		}
+	case Secret:
+		quoted, _ := tomlQuote(v.String())
+		return quoted, "secret reference converted to a string"
+	}
+
+	typ := reflect.TypeOf(v).String()
+	if literal, ok := formatCustom(v); ok {
+		quoted, _ := tomlQuote(literal)
+		return quoted, typ + " converted to a string"
+	}
+
+	return "", fmt.Sprintf("%s cannot be represented in TOML", typ)
+}
+
+// Formats a dotted key, quoting segments where necessary.
+func tomlKey(key string) string {
+	parts := SplitKey(key)
+
+	for i, part := range parts {
+		if !reTOMLBareKey.MatchString(part) {
+			parts[i], _ = tomlQuote(part)
+		}
+	}
+
+	return strings.Join(parts, ".")
+}
+
+// Quotes a string as a TOML basic string. The second return value is false
+// if the string wasn't valid UTF-8.
+func tomlQuote(s string) (string, bool) {
+	var buf bytes.Buffer
+	valid := true
+
+	buf.WriteByte('"')
+
+	for i, r := range s {
+		switch {
+		case r == utf8.RuneError && strings.HasPrefix(s[i:], "\xef\xbf\xbd"):
+			buf.WriteRune(r)
+		case r == utf8.RuneError:
+			valid = false
+			buf.WriteRune(r)
+		case r == '"' || r == '\\':
+			buf.WriteByte('\\')
+			buf.WriteRune(r)
+		case r == '\t':
+			buf.WriteString(`\t`)
+		case r == '\n':
+			buf.WriteString(`\n`)
+		case r == '\r':
+			buf.WriteString(`\r`)
+		case r < 0x20 || r == 0x7f:
+			fmt.Fprintf(&buf, `\u%04X`, r)
+		default:
+			buf.WriteRune(r)
+		}
+	}
+
+	buf.WriteByte('"')
+
+	return buf.String(), valid
+}
@@ -0,0 +1,212 @@
+package walnut
+
+import (
+	"fmt"
+	"math"
+	"testing"
+	"time"
+)
+
+var fromTOMLTests = []struct {
+	in       string
+	want     string
+	warnings []Warning
+	err      error
+}{
+	{"", "", nil, nil},
+	{"# comment\n\n", "", nil, nil},
+	{"a = true", "a = true\n", nil, nil},
+	{"a = 1_000 # big", "a = 1000\n", nil, nil},
+	{"a = 0xff\nb = 0o17\nc = 0b11", "a = 255\nb = 15\nc = 3\n", nil, nil},
+	{"a = 0\nb = -0\nc = 0.5\nd = 0e1", "a = 0\nb = 0\nc = 0.5\nd = 0.0\n", nil, nil},
+	{"a = 0755", "", nil, fmt.Errorf(errTOMLSyntax, 1, "invalid number 0755")},
+	{"a = 08", "", nil, fmt.Errorf(errTOMLSyntax, 1, "invalid number 08")},
+	{"a = 08.5", "", nil, fmt.Errorf(errTOMLSyntax, 1, "invalid number 08.5")},
+	{"a = 0x-1", "", nil, fmt.Errorf(errTOMLSyntax, 1, "invalid number 0x-1")},
+	{"a = 6.5e3", "a = 6500.0\n", nil, nil},
+	{"a = \"x\\ty\\u2603\"", "a = \"x\\ty☃\"\n", nil, nil},
+	{"a = 'C:\\dir'", "a = \"C:\\\\dir\"\n", nil, nil},
+	{"a = \"\"\"\none\ntwo\"\"\"", "a = \"one\\ntwo\"\n", nil, nil},
+	{"a = '''\nraw\\n'''", "a = \"raw\\\\n\"\n", nil, nil},
+	{"a = \"90s\"", "a = 90s\n", nil, nil},
+	{"a = 1979-05-27T07:32:00Z", "a = 1979-05-27 07:32:00 +0000\n", nil, nil},
+	{"a = 1979-05-27 00:32:00.5-07:00", "a = 1979-05-27 00:32:00.5 -0700\n", nil, nil},
+	{"[http]\nhost = \"localhost\"\nport = 8080", "http\n  host = \"localhost\"\n  port = 8080\n", nil, nil},
+	{"a.b = 1\n[c.\"d\"]\ne = {f = 2, g.h = 3}", "a\n  b = 1\nc\n  d\n    e\n      f = 2\n      g\n        h = 3\n", nil, nil},
+	{
+		"a = 1979-05-27T07:32:00",
+		"a = 1979-05-27 07:32:00 +0000\n",
+		[]Warning{{"a", "local date-time converted assuming UTC"}},
+		nil,
+	},
+	{
+		"a = 1979-05-27\nb = 07:32:00\nc = 07:32:00.1234567891",
+		"a = 1979-05-27\nb = 07:32:00\nc = \"07:32:00.1234567891\"\n",
+		[]Warning{{"c", "local date or time converted to a string"}},
+		nil,
+	},
+	{
+		"a = [1,\n  2, # two\n]\nb = nan\nc = -inf\nd = 1e3",
+		"b = nan\nc = -inf\nd = 1000.0\n",
+		[]Warning{{"a", "arrays cannot be represented in walnut"}},
+		nil,
+	},
+	{
+		"[[a]]\nb = 1\n[a.c]\nd = 2\n[[a]]\nb = 2\n[e]\nf = 3",
+		"e\n  f = 3\n",
+		[]Warning{{"a", "arrays of tables cannot be represented in walnut"}},
+		nil,
+	},
+	{"a = 1\na = 2", "", nil, fmt.Errorf(errTOMLDuplicate, "a")},
+	{"[a]\nb = 1\n[a]\nc = 2", "", nil, fmt.Errorf(errTOMLDuplicate, "a")},
+	{"a = 1\n[a]", "", nil, fmt.Errorf(errTOMLDuplicate, "a")},
+	{"a = 1\na.b = 2", "", nil, fmt.Errorf(errImportConflict, "a.b", "a")},
+	{"\"a.b\" = 1\n[\"c d\"]\ne = {\"f.g\" = 2}", "\"a.b\" = 1\n\"c d\"\n  e\n    \"f.g\" = 2\n", nil, nil},
+	{"a = \"open", "", nil, fmt.Errorf(errTOMLSyntax, 1, "unterminated string")},
+	{"\n[a\n", "", nil, fmt.Errorf(errTOMLSyntax, 2, "expected ]")},
+	{"a = 1 2", "", nil, fmt.Errorf(errTOMLSyntax, 1, "expected end of line")},
+	{"\ra = 1", "", nil, fmt.Errorf(errTOMLSyntax, 1, "expected key")},
+	{"a = [1,\r2]", "", nil, fmt.Errorf(errTOMLSyntax, 1, "expected value")},
+	{"a = 1\r\nb = 2", "a = 1\nb = 2\n", nil, nil},
+	{"a = 1__0", "", nil, fmt.Errorf(errTOMLSyntax, 1, "invalid number 1__0")},
+}
+
+func TestFromTOML(t *testing.T) {
+	for _, test := range fromTOMLTests {
+		out, warnings, err := FromTOML([]byte(test.in))
+		if string(out) != test.want || !sameWarnings(warnings, test.warnings) || !eq(err, test.err) {
+			t.Errorf("FromTOML(%q):", test.in)
+			t.Errorf("   got %q, %v, %v", out, warnings, err)
+			t.Errorf("  want %q, %v, %v", test.want, test.warnings, test.err)
+		}
+	}
+}
+
+var toTOMLTests = []struct {
+	in       map[string]interface{}
+	want     string
+	warnings []Warning
+}{
+	{map[string]interface{}{}, "", nil},
+	{
+		map[string]interface{}{
+			"b":       int64(2),
+			"a":       true,
+			"x.y":     "a\"b\x01",
+			"x.z.w":   float64(1),
+			"x.inf":   math.Inf(-1),
+			"x.sp ce": "",
+		},
+		"a = true\nb = 2\n\n[x]\ninf = -inf\n\"sp ce\" = \"\"\ny = \"a\\\"b\\u0001\"\n\n[x.z]\nw = 1.0\n",
+		nil,
+	},
+	{
+		map[string]interface{}{
+			"t": time.Date(2013, 2, 25, 17, 7, 46, 409000000, time.FixedZone("", 3600)),
+			"d": 90 * time.Minute,
+		},
+		"d = \"1h 30m\"\nt = 2013-02-25T17:07:46.409+01:00\n",
+		[]Warning{{"d", "duration converted to a string"}},
+	},
+	{
+		map[string]interface{}{
+			"a": Date{2013, time.February, 25},
+			"b": TimeOfDay{22, 30, 0, 0},
+			"c": time.Date(2013, 7, 25, 17, 7, 46, 0, berlin),
+		},
+		"a = 2013-02-25\nb = 22:30:00\nc = 2013-07-25T17:07:46+02:00\n",
+		[]Warning{{"c", "zone Europe/Berlin converted to an offset"}},
+	},
+	{
+		map[string]interface{}{"a": Null{}, "b": int64(1)},
+		"b = 1\n",
+		[]Warning{{"a", "nulls cannot be represented in TOML"}},
+	},
+}
+
+func TestToTOML(t *testing.T) {
+	for _, test := range toTOMLTests {
+		out, warnings, err := ToTOML(&config{data: test.in})
+		if string(out) != test.want || !sameWarnings(warnings, test.warnings) || err != nil {
+			t.Errorf("ToTOML(%v):", test.in)
+			t.Errorf("   got %q, %v, %v", out, warnings, err)
+			t.Errorf("  want %q, %v, %v", test.want, test.warnings, nil)
+		}
+	}
+}
+
+// Strings which look like other types are read back as those types, so
+// they must be warned about.
+func TestTOMLAmbiguousStrings(t *testing.T) {
+	for _, s := range []string{"5s", "10.0.0.1", "64KiB", "hello", "true"} {
+		conf := &config{data: map[string]interface{}{"a": s}}
+
+		doc, warnings, err := ToTOML(conf)
+		if err != nil {
+			t.Fatalf("ToTOML(%q): %v", s, err)
+		}
+
+		src, _, err := FromTOML(doc)
+		if err != nil {
+			t.Fatalf("FromTOML(%s): %v", doc, err)
+		}
+
+		out, err := Read(src)
+		if err != nil {
+			t.Fatalf("Read(%q): %v", src, err)
+		}
+
+		got, _ := out.Get("a")
+		if changed := got != s; changed != (len(warnings) > 0) {
+			t.Errorf("TOML round trip of %q:", s)
+			t.Errorf("   got %#v with warnings %v", got, warnings)
+		}
+	}
+}
+
+func TestTOMLRoundTripKeys(t *testing.T) {
+	testRoundTripKeys(t, "TOML", quotedKeys, func(conf Config) ([]byte, error) {
+		doc, _, err := ToTOML(conf)
+		if err != nil {
+			return nil, err
+		}
+		src, _, err := FromTOML(doc)
+		return src, err
+	})
+}
+
+func TestTOMLRoundTrip(t *testing.T) {
+	for _, want := range roundTripValues {
+		conf := &config{data: map[string]interface{}{"a.b": want}}
+
+		doc, _, err := ToTOML(conf)
+		if err != nil {
+			t.Errorf("ToTOML(%#v): %v", want, err)
+			continue
+		}
+
+		src, _, err := FromTOML(doc)
+		if err != nil {
+			t.Errorf("FromTOML(%s): %v", doc, err)
+			continue
+		}
+
+		out, err := Read(src)
+		if err != nil {
+			t.Errorf("Read(%q): %v", src, err)
+			continue
+		}
+
+		got, _ := out.Get("a.b")
+		if !sameValue(got, want) {
+			t.Errorf("TOML round trip of %#v:", want)
+			t.Errorf("   got %#v", got)
+			t.Errorf("  want %#v", want)
+		}
+	}
+}
+
+// Compares two lists of warnings, treating nil and empty lists as equal.
+func sameWarnings(a, b []Warning) bool {
+	return len(a) == 0 && len(b) == 0 || eq(a, b)
+}
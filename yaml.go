@@ -0,0 +1,514 @@
+package walnut
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"net/netip"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	errYAMLSyntax      = "YAML syntax error on line %d: %s"
+	errYAMLUnsupported = "unsupported YAML on line %d: %s"
+	errYAMLDuplicate   = "YAML key %q defined twice"
+)
+
+var (
+	reYAMLInt      = regexp.MustCompile(`^(?:[\-\+]?\d+|0o[0-7]+|0x[0-9a-fA-F]+)$`)
+	reYAMLFloat    = regexp.MustCompile(`^[\-\+]?(?:\.\d+|\d+(?:\.\d*)?)(?:[eE][\-\+]?\d+)?$`)
+	reYAMLPlainKey = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_\-]*$`)
+)
+
+// Converts a YAML document to walnut source. Only block mappings and scalars
+// are supported; mappings become key groups. Plain scalars are resolved
+// according to YAML 1.2's core schema, and strings holding durations,
+// timestamps and the like are converted like in FromJSON.
+//
+// Sequences and flow collections have no walnut equivalent and are skipped,
+// with a Warning for each. Anchors, aliases, tags and multi-document streams
+// are rejected.
+func FromYAML(in []byte) ([]byte, []Warning, error) {
+	lines := strings.Split(strings.Replace(string(in), "\r\n", "\n", -1), "\n")
+
+	type group struct {
+		indent  int
+		key     string
+		entries int // indentation of the group's entries
+	}
+
+	table := make(map[string]string)
+	warnings := make([]Warning, 0)
+	stack := make([]group, 0)
+	documents := 0
+
+	// indentation of the top-level entries
+	top := -1
+
+	// key of a mapping entry without a value, which is either a group or
+	// an (implicit) null
+	pending := ""
+	pendingIndent := -1
+
+	// sequences are skipped until the indentation drops back to this level
+	skip := -1
+
+	for i := 0; i < len(lines); i++ {
+		index := i + 1
+		content := stripYAMLComment(lines[i])
+		trimmed := strings.TrimLeft(content, " ")
+		indent := len(content) - len(trimmed)
+
+		if strings.TrimSpace(trimmed) == "" {
+			continue
+		}
+		if strings.HasPrefix(trimmed, "\t") {
+			return nil, nil, fmt.Errorf(errYAMLSyntax, index, "tabs are not allowed in indentation")
+		}
+
+		if indent == 0 && (trimmed == "---" || strings.HasPrefix(trimmed, "--- ")) {
+			if documents++; documents > 1 || len(table) > 0 {
+				return nil, nil, fmt.Errorf(errYAMLUnsupported, index, "multiple documents")
+			}
+			continue
+		}
+		if indent == 0 && trimmed == "..." {
+			break
+		}
+
+		sequence := trimmed == "-" || strings.HasPrefix(trimmed, "- ")
+
+		if skip >= 0 {
+			if indent > skip || indent == skip && sequence {
+				continue
+			}
+			skip = -1
+		}
+
+		if pending != "" {
+			switch {
+			case sequence && indent >= pendingIndent:
+				warnings = append(warnings, Warning{pending, "sequences cannot be represented in walnut"})
+				skip = pendingIndent
+				pending = ""
+				continue
+			case indent > pendingIndent:
+				stack = append(stack, group{pendingIndent, pending, indent})
+			default:
+				table[pending] = "null"
+			}
+			pending = ""
+		}
+
+		for len(stack) > 0 && stack[len(stack)-1].indent >= indent {
+			stack = stack[:len(stack)-1]
+		}
+
+		if sequence {
+			return nil, nil, fmt.Errorf(errYAMLUnsupported, index, "top-level sequences")
+		}
+
+		// entries of the same mapping must be indented alike
+		if top < 0 {
+			top = indent
+		}
+		want := top
+		if len(stack) > 0 {
+			want = stack[len(stack)-1].entries
+		}
+		if indent != want {
+			return nil, nil, fmt.Errorf(errYAMLSyntax, index, "inconsistent indentation")
+		}
+
+		name, rest, err := splitYAMLEntry(trimmed)
+		if err != nil {
+			return nil, nil, fmt.Errorf(errYAMLSyntax, index, err)
+		}
+		key := quoteKey(name)
+		if len(stack) > 0 {
+			key = stack[len(stack)-1].key + "." + key
+		}
+
+		if _, ok := table[key]; ok {
+			return nil, nil, fmt.Errorf(errYAMLDuplicate, key)
+		}
+
+		switch {
+		case rest == "":
+			pending, pendingIndent = key, indent
+			continue
+		case rest[0] == '&' || rest[0] == '*' || rest[0] == '!':
+			return nil, nil, fmt.Errorf(errYAMLUnsupported, index, "anchors, aliases and tags")
+		case rest[0] == '[' || rest[0] == '{':
+			warnings = append(warnings, Warning{key, "flow collections cannot be represented in walnut"})
+			continue
+		case rest[0] == '|' || rest[0] == '>':
+			var s string
+			s, i = yamlBlockScalar(lines, i, indent, rest)
+			table[key] = strconv.Quote(s)
+			continue
+		}
+
+		v, err := yamlScalar(rest)
+		if err != nil {
+			return nil, nil, fmt.Errorf(errYAMLSyntax, index, err)
+		}
+
+		literal, warning := yamlLiteral(v)
+		if warning != "" {
+			warnings = append(warnings, Warning{key, warning})
+		}
+		if literal != "" {
+			table[key] = literal
+		}
+	}
+
+	if pending != "" {
+		table[pending] = "null"
+	}
+
+	out, err := writeTable(table)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return out, warnings, nil
+}
+
+// Splits a "key: value" mapping entry into its key and value.
+func splitYAMLEntry(in string) (string, string, error) {
+	var key string
+	var rest string
+
+	switch in[0] {
+	case '"':
+		n := quotedLength(in, '"')
+		if n < 0 {
+			return "", "", fmt.Errorf("unterminated string")
+		}
+		unquoted, err := yamlScalar(in[:n])
+		if err != nil {
+			return "", "", err
+		}
+		key, rest = unquoted.(string), in[n:]
+	case '\'':
+		n := quotedLength(in, '\'')
+		if n < 0 {
+			return "", "", fmt.Errorf("unterminated string")
+		}
+		unquoted, _ := yamlScalar(in[:n])
+		key, rest = unquoted.(string), in[n:]
+	default:
+		i := strings.Index(in, ": ")
+		if i < 0 && strings.HasSuffix(in, ":") {
+			i = len(in) - 1
+		}
+		if i < 0 {
+			return "", "", fmt.Errorf("expected mapping entry")
+		}
+		key, rest = strings.TrimRight(in[:i], " "), in[i:]
+	}
+
+	if !strings.HasPrefix(rest, ":") || len(rest) > 1 && rest[1] != ' ' {
+		return "", "", fmt.Errorf("expected mapping entry")
+	}
+
+	return key, strings.Trim(rest[1:], " "), nil
+}
+
+// Returns the length of the quoted string at the beginning of the input, or
+// -1 if it isn't terminated. Single-quoted strings escape quotes by doubling
+// them, double-quoted ones use backslashes.
+func quotedLength(in string, quote byte) int {
+	for i := 1; i < len(in); i++ {
+		switch {
+		case quote == '"' && in[i] == '\\':
+			i++
+		case in[i] == quote && quote == '\'' && i+1 < len(in) && in[i+1] == '\'':
+			i++
+		case in[i] == quote:
+			return i + 1
+		}
+	}
+
+	return -1
+}
+
+// Removes a trailing comment from a line, taking quoted strings into account.
+func stripYAMLComment(line string) string {
+	for i := 0; i < len(line); i++ {
+		switch b := line[i]; {
+		case (b == '"' || b == '\'') && (i == 0 || line[i-1] == ' '):
+			if n := quotedLength(line[i:], b); n > 0 {
+				i += n - 1
+			}
+		case b == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return strings.TrimRight(line[:i], " \t")
+		}
+	}
+
+	return strings.TrimRight(line, " \t")
+}
+
+// Reads a literal (|) or folded (>) block scalar whose header is on line i.
+// Returns the scalar's value and the index of its last line.
+func yamlBlockScalar(lines []string, i, parent int, header string) (string, int) {
+	body := make([]string, 0)
+	indent := -1
+
+	for i+1 < len(lines) {
+		line := strings.TrimRight(lines[i+1], "\r")
+		trimmed := strings.TrimLeft(line, " ")
+
+		if trimmed == "" {
+			body = append(body, "")
+			i++
+			continue
+		}
+
+		n := len(line) - len(trimmed)
+		if indent < 0 {
+			indent = n
+		}
+		if n <= parent || n < indent {
+			break
+		}
+
+		body = append(body, line[indent:])
+		i++
+	}
+
+	// trailing blank lines belong to whatever follows the block, unless
+	// they're kept by the chomping indicator
+	trailing := 0
+	for len(body) > 0 && body[len(body)-1] == "" {
+		body = body[:len(body)-1]
+		trailing++
+	}
+
+	var s string
+	if header[0] == '|' {
+		s = strings.Join(body, "\n")
+	} else {
+		s = strings.Replace(strings.Join(body, "\n"), "\n\n", "\x00", -1)
+		s = strings.Replace(s, "\n", " ", -1)
+		s = strings.Replace(s, "\x00", "\n", -1)
+	}
+
+	switch {
+	case strings.Contains(header, "-"):
+	case strings.Contains(header, "+"):
+		s += strings.Repeat("\n", trailing+1)
+	case len(body) > 0:
+		s += "\n"
+	}
+
+	return s, i
+}
+
+// Resolves a scalar to a Go value. Quoted scalars are always strings; plain
+// scalars are resolved using the YAML 1.2 core schema.
+func yamlScalar(in string) (interface{}, error) {
+	switch in[0] {
+	case '"':
+		if n := quotedLength(in, '"'); n != len(in) {
+			return nil, fmt.Errorf("invalid double-quoted string")
+		}
+		s, err := strconv.Unquote(in)
+		if err != nil {
+			return nil, fmt.Errorf("invalid double-quoted string")
+		}
+		return s, nil
+	case '\'':
+		if n := quotedLength(in, '\''); n != len(in) {
+			return nil, fmt.Errorf("invalid single-quoted string")
+		}
+		return strings.Replace(in[1:len(in)-1], "''", "'", -1), nil
+	}
+
+	switch in {
+	case "~", "null", "Null", "NULL":
+		return nil, nil
+	case "true", "True", "TRUE":
+		return true, nil
+	case "false", "False", "FALSE":
+		return false, nil
+	case ".inf", ".Inf", ".INF", "+.inf", "+.Inf", "+.INF":
+		return math.Inf(1), nil
+	case "-.inf", "-.Inf", "-.INF":
+		return math.Inf(-1), nil
+	case ".nan", ".NaN", ".NAN":
+		return math.NaN(), nil
+	}
+
+	if reYAMLInt.MatchString(in) {
+		// unlike in Go, a leading zero doesn't make a number octal
+		base := 10
+		switch {
+		case strings.HasPrefix(in, "0o"):
+			base, in = 8, in[2:]
+		case strings.HasPrefix(in, "0x"):
+			base, in = 16, in[2:]
+		}
+
+		if v, err := strconv.ParseInt(in, base, 64); err == nil {
+			return v, nil
+		}
+		return nil, fmt.Errorf("integer out of range")
+	}
+
+	if reYAMLFloat.MatchString(in) {
+		if v, err := strconv.ParseFloat(in, 64); err == nil {
+			return v, nil
+		}
+	}
+
+	return in, nil
+}
+
+// Converts a resolved YAML scalar to a walnut literal. Returns an empty
+// literal if the value is dropped, and a non-empty warning if the conversion
+// wasn't lossless.
+func yamlLiteral(v interface{}) (string, string) {
+	switch v := v.(type) {
+	case nil:
+		return "null", ""
+	case bool, int64:
+		literal, _ := formatLiteral(v)
+		return literal, ""
+	case float64:
+		return formatFloat64(v), ""
+	case string:
+		return stringLiteral(v), ""
+	}
+
+	return "", fmt.Sprintf("unsupported YAML value %v", v)
+}
+
+// Encodes a Config as a YAML document of nested block mappings.
+//
+// Timestamps are written in RFC 3339 format, which most YAML libraries
+// recognize, though zone names are replaced by offsets. Durations, periods,
+// byte sizes, dates and times of day are written as strings holding their
+// walnut literals, which FromYAML converts back. Each of these losses is
+// reported as a Warning, as are values of types YAML cannot represent and
+// strings which FromYAML would convert in the same way, e.g. "5s".
+func ToYAML(conf Config) ([]byte, []Warning, error) {
+	var buf bytes.Buffer
+	var prev []string
+	warnings := make([]Warning, 0)
+
+	for _, key := range conf.Keys() {
+		v, _ := conf.Get(key)
+
+		literal, warning := formatYAML(v)
+		if warning != "" {
+			warnings = append(warnings, Warning{key, warning})
+		}
+		if literal == "" {
+			continue
+		}
+
+		parts := SplitKey(key)
+		last := len(parts) - 1
+
+		common := 0
+		for common < len(prev)-1 && common < last && prev[common] == parts[common] {
+			common++
+		}
+
+		for j := common; j < last; j++ {
+			fmt.Fprintf(&buf, "%s%s:\n", strings.Repeat("  ", j), yamlKey(parts[j]))
+		}
+
+		fmt.Fprintf(&buf, "%s%s: %s\n", strings.Repeat("  ", last), yamlKey(parts[last]), literal)
+		prev = parts
+	}
+
+	return buf.Bytes(), warnings, nil
+}
+
+// Formats a value as a YAML scalar. Returns an empty literal if the value
+// can't be represented, and a non-empty warning if the conversion wasn't
+// lossless.
+func formatYAML(v interface{}) (string, string) {
+	switch v := v.(type) {
+	case Null:
+		return "null", ""
+	case bool, int64:
+		literal, _ := formatLiteral(v)
+		return literal, ""
+	case float64:
+		switch {
+		case math.IsNaN(v):
+			return ".nan", ""
+		case math.IsInf(v, 1):
+			return ".inf", ""
+		case math.IsInf(v, -1):
+			return "-.inf", ""
+		}
+		return formatFloat64(v), ""
+	case string:
+		if !utf8.ValidString(v) {
+			return strconv.Quote(v), "invalid UTF-8 cannot be represented in YAML"
+		}
+		// FromYAML reads e.g. "5s" as a duration
+		if stringLiteral(v) != strconv.Quote(v) {
+			return strconv.Quote(v), "string would be read back as another type"
+		}
+		return strconv.Quote(v), ""
+	case time.Time:
+		if name := zoneName(v); name != "" {
+			return v.Format(time.RFC3339Nano), "zone " + name + " converted to an offset"
+		}
+		return v.Format(time.RFC3339Nano), ""
+	case Date:
+		return strconv.Quote(v.String()), "date converted to a string"
+	case TimeOfDay:
+		return strconv.Quote(v.String()), "time of day converted to a string"
+	case time.Duration:
+		literal := formatDuration(v)
+		return strconv.Quote(literal), "duration converted to a string"
+	case Period:
+		return strconv.Quote(v.String()), "period converted to a string"
+	case ByteSize:
+		return strconv.Quote(v.String()), "byte size converted to a string"
+	case netip.Addr, netip.Prefix, netip.AddrPort:
+		if literal, ok := formatLiteral(v); ok {
+			return strconv.Quote(literal), "address converted to a string"
+		}
+	case *url.URL:
+		if literal, ok := formatURL(v); ok {
+			return strconv.Quote(literal), "URL converted to a string"
+		}
+	case Secret:
+		return strconv.Quote(v.String()), "secret reference converted to a string"
+	}
+
+	typ := reflect.TypeOf(v).String()
+	if literal, ok := formatCustom(v); ok {
+		return strconv.Quote(literal), typ + " converted to a string"
+	}
+
+	return "", fmt.Sprintf("%s cannot be represented in YAML", typ)
+}
+
+// Formats a mapping key, quoting it unless it's unambiguously a plain
+// string.
+func yamlKey(key string) string {
+	if reYAMLPlainKey.MatchString(key) {
+		switch strings.ToLower(key) {
+		case "true", "false", "null", "yes", "no", "on", "off", "y", "n":
+		default:
+			return key
+		}
+	}
+
+	return strconv.Quote(key)
+}
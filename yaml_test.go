@@ -0,0 +1,186 @@
+package walnut
+
+import (
+	"fmt"
+	"math"
+	"testing"
+	"time"
+)
+
+var fromYAMLTests = []struct {
+	in       string
+	want     string
+	warnings []Warning
+	err      error
+}{
+	{"", "", nil, nil},
+	{"---\n# comment\n", "", nil, nil},
+	{"a: true", "a = true\n", nil, nil},
+	{"a: 12 # comment", "a = 12\n", nil, nil},
+	{"a: 0x1f\nb: 0o17\nc: -3", "a = 31\nb = 15\nc = -3\n", nil, nil},
+	{"a: 0755\nb: 08\nc: -010", "a = 755\nb = 8\nc = -10\n", nil, nil},
+	{"a: 1e3\nb: .5", "a = 1000.0\nb = 0.5\n", nil, nil},
+	{"a: hello world", "a = \"hello world\"\n", nil, nil},
+	{"a: \"x # y\\n\"", "a = \"x # y\\n\"\n", nil, nil},
+	{"a: 'it''s'", "a = \"it's\"\n", nil, nil},
+	{"a: \"true\"", "a = \"true\"\n", nil, nil},
+	{"a: 1h 30m", "a = 1h 30m\n", nil, nil},
+	{"a: 2001-12-14T21:59:43.1-05:00", "a = 2001-12-14T21:59:43.1-05:00\n", nil, nil},
+	{
+		"http:\n  host: localhost\n  port: 8080\nx:\n    y:\n        z: 1",
+		"http\n  host = \"localhost\"\n  port = 8080\nx\n  y\n    z = 1\n",
+		nil,
+		nil,
+	},
+	{"\"a b\": 1\n\"c.d\":\n  e: 2", "\"a b\" = 1\n\"c.d\"\n  e = 2\n", nil, nil},
+	{"a: |\n  one\n  two\n\nb: 1", "a = \"one\\ntwo\\n\"\nb = 1\n", nil, nil},
+	{"a: |-\n  one\n   two", "a = \"one\\n two\"\n", nil, nil},
+	{"a: >\n  one\n  two\n\n  three\n", "a = \"one two\\nthree\\n\"\n", nil, nil},
+	{
+		"a:\n  - 1\n  - 2\nb:\n- 3\nc: 4",
+		"c = 4\n",
+		[]Warning{
+			{"a", "sequences cannot be represented in walnut"},
+			{"b", "sequences cannot be represented in walnut"},
+		},
+		nil,
+	},
+	{
+		"a: [1, 2]\nb: {c: 1}\nd:\ne: ~\nf: .nan",
+		"d = null\ne = null\nf = nan\n",
+		[]Warning{
+			{"a", "flow collections cannot be represented in walnut"},
+			{"b", "flow collections cannot be represented in walnut"},
+		},
+		nil,
+	},
+	{"a: 1\na: 2", "", nil, fmt.Errorf(errYAMLDuplicate, "a")},
+	{"a: &x 1", "", nil, fmt.Errorf(errYAMLUnsupported, 1, "anchors, aliases and tags")},
+	{"a: 1\n---\nb: 2", "", nil, fmt.Errorf(errYAMLUnsupported, 2, "multiple documents")},
+	{"- 1", "", nil, fmt.Errorf(errYAMLUnsupported, 1, "top-level sequences")},
+	{"a: 1\nplain text", "", nil, fmt.Errorf(errYAMLSyntax, 2, "expected mapping entry")},
+	{"a:\n    b: 1\n  c: 2", "", nil, fmt.Errorf(errYAMLSyntax, 3, "inconsistent indentation")},
+	{"  a: 1\nb: 2", "", nil, fmt.Errorf(errYAMLSyntax, 2, "inconsistent indentation")},
+	{"a: 99999999999999999999", "", nil, fmt.Errorf(errYAMLSyntax, 1, "integer out of range")},
+}
+
+func TestFromYAML(t *testing.T) {
+	for _, test := range fromYAMLTests {
+		out, warnings, err := FromYAML([]byte(test.in))
+		if string(out) != test.want || !sameWarnings(warnings, test.warnings) || !eq(err, test.err) {
+			t.Errorf("FromYAML(%q):", test.in)
+			t.Errorf("   got %q, %v, %v", out, warnings, err)
+			t.Errorf("  want %q, %v, %v", test.want, test.warnings, test.err)
+		}
+	}
+}
+
+var toYAMLTests = []struct {
+	in       map[string]interface{}
+	want     string
+	warnings []Warning
+}{
+	{map[string]interface{}{}, "", nil},
+	{
+		map[string]interface{}{
+			"b":     int64(2),
+			"a":     true,
+			"x.y":   "a\"b\x01",
+			"x.z.w": float64(1),
+			"x.no":  math.Inf(1),
+			"x.v":   Null{},
+		},
+		"a: true\nb: 2\nx:\n  \"no\": .inf\n  v: null\n  \"y\": \"a\\\"b\\x01\"\n  z:\n    w: 1.0\n",
+		nil,
+	},
+	{
+		map[string]interface{}{
+			"t": time.Date(2013, 2, 25, 17, 7, 46, 409000000, time.FixedZone("", 3600)),
+			"d": 90 * time.Minute,
+		},
+		"d: \"1h 30m\"\nt: 2013-02-25T17:07:46.409+01:00\n",
+		[]Warning{{"d", "duration converted to a string"}},
+	},
+}
+
+func TestToYAML(t *testing.T) {
+	for _, test := range toYAMLTests {
+		out, warnings, err := ToYAML(&config{data: test.in})
+		if string(out) != test.want || !sameWarnings(warnings, test.warnings) || err != nil {
+			t.Errorf("ToYAML(%v):", test.in)
+			t.Errorf("   got %q, %v, %v", out, warnings, err)
+			t.Errorf("  want %q, %v, %v", test.want, test.warnings, nil)
+		}
+	}
+}
+
+// Strings which look like other types are read back as those types, so
+// they must be warned about.
+func TestYAMLAmbiguousStrings(t *testing.T) {
+	for _, s := range []string{"5s", "10.0.0.1", "64KiB", "hello", "true"} {
+		conf := &config{data: map[string]interface{}{"a": s}}
+
+		doc, warnings, err := ToYAML(conf)
+		if err != nil {
+			t.Fatalf("ToYAML(%q): %v", s, err)
+		}
+
+		src, _, err := FromYAML(doc)
+		if err != nil {
+			t.Fatalf("FromYAML(%s): %v", doc, err)
+		}
+
+		out, err := Read(src)
+		if err != nil {
+			t.Fatalf("Read(%q): %v", src, err)
+		}
+
+		got, _ := out.Get("a")
+		if changed := got != s; changed != (len(warnings) > 0) {
+			t.Errorf("YAML round trip of %q:", s)
+			t.Errorf("   got %#v with warnings %v", got, warnings)
+		}
+	}
+}
+
+func TestYAMLRoundTripKeys(t *testing.T) {
+	testRoundTripKeys(t, "YAML", quotedKeys, func(conf Config) ([]byte, error) {
+		doc, _, err := ToYAML(conf)
+		if err != nil {
+			return nil, err
+		}
+		src, _, err := FromYAML(doc)
+		return src, err
+	})
+}
+
+func TestYAMLRoundTrip(t *testing.T) {
+	for _, want := range roundTripValues {
+		conf := &config{data: map[string]interface{}{"a.b": want}}
+
+		doc, _, err := ToYAML(conf)
+		if err != nil {
+			t.Errorf("ToYAML(%#v): %v", want, err)
+			continue
+		}
+
+		src, _, err := FromYAML(doc)
+		if err != nil {
+			t.Errorf("FromYAML(%s): %v", doc, err)
+			continue
+		}
+
+		out, err := Read(src)
+		if err != nil {
+			t.Errorf("Read(%q): %v", src, err)
+			continue
+		}
+
+		got, _ := out.Get("a.b")
+		if !sameValue(got, want) {
+			t.Errorf("YAML round trip of %#v:", want)
+			t.Errorf("   got %#v", got)
+			t.Errorf("  want %#v", want)
+		}
+	}
+}